@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"reflect"
 	"syscall"
 	"time"
 
@@ -15,9 +16,16 @@ import (
 	"github.com/Valentin-Kaiser/go-core/zlog"
 	"github.com/Valentin-Kaiser/hdns/pkg/config"
 	"github.com/Valentin-Kaiser/hdns/pkg/dns"
+	"github.com/Valentin-Kaiser/hdns/pkg/dns/hetznertest"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
 	"github.com/Valentin-Kaiser/hdns/pkg/service"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/spf13/pflag"
+)
+
+var (
+	demo = pflag.Bool("demo", false, "Run against an in-memory fake of the Hetzner DNS API, use the API token \"demo\"")
 )
 
 func init() {
@@ -41,7 +49,9 @@ func init() {
 				log.Error().Err(err).Msg("[Service] web server failed to restart")
 			}
 		}
-		if o.Service.Refresh != n.Service.Refresh {
+		// The watched interfaces depend on the address sources and uplinks
+		if o.Service.Refresh != n.Service.Refresh || o.Service.Watch != n.Service.Watch ||
+			!reflect.DeepEqual(o.Service.Sources, n.Service.Sources) || !reflect.DeepEqual(o.Service.Uplinks, n.Service.Uplinks) {
 			dns.Restart()
 		}
 		return nil
@@ -76,8 +86,30 @@ func main() {
 		}
 	}
 
+	if *demo {
+		fake := hetznertest.NewServer("demo")
+		fake.AddZone("example.com")
+		fake.AddZone("example.org")
+		dns.HetznerBaseURL = fake.URL
+		log.Warn().Msgf("[Demo] hetzner provider uses the fake API at %s, use the API token \"demo\"", fake.URL)
+	}
+
 	go database.Connect(time.Second, config.Get().Database)
 	database.AwaitConnection()
+	err := model.DropLegacyIndexes()
+	if err != nil {
+		log.Error().Err(err).Msg("[Database] failed to migrate the database")
+	}
+
+	if pflag.Arg(0) == "migrate" {
+		err := migrate()
+		if err != nil {
+			log.Error().Err(err).Msg("[Migration] migration failed")
+			os.Exit(1)
+		}
+		return
+	}
+
 	dns.Refresh() // Initial refresh on startup
 	dns.Start()
 	go service.Start()
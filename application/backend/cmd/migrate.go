@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/hdns/pkg/dns"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+	"github.com/spf13/pflag"
+)
+
+var (
+	migrateZone        = pflag.String("zone", "", "Zone to move with the migrate command, e.g. example.com")
+	migrateSourceToken = pflag.String("source-token", "", "Hetzner DNS Console API token for the migrate command")
+	migrateTargetToken = pflag.String("target-token", "", "Hetzner Cloud API token for the migrate command")
+	migrateDryRun      = pflag.Bool("dry-run", false, "Only print the changes the migrate command would apply")
+)
+
+// migrate moves a zone from the Hetzner DNS Console to Hetzner Cloud DNS
+// Usage: hdns migrate --zone example.com --source-token <token> --target-token <token> [--dry-run]
+func migrate() error {
+	if *migrateSourceToken == "" || *migrateTargetToken == "" {
+		return apperror.NewError("--source-token and --target-token are required")
+	}
+
+	result, err := dns.Migrate(dns.Migration{
+		Zone:   *migrateZone,
+		Source: model.Credential{Provider: "hetzner", Token: model.Token(*migrateSourceToken)},
+		Target: model.Credential{Provider: "hetzner-cloud", Token: model.Token(*migrateTargetToken)},
+		DryRun: *migrateDryRun,
+	})
+	if result != nil {
+		printMigration(result)
+	}
+	return apperror.Wrap(err)
+}
+
+func printMigration(result *dns.MigrationResult) {
+	mode := ""
+	if result.DryRun {
+		mode = " (dry run)"
+	}
+	fmt.Printf("zone %s: %s -> %s%s\n", result.Zone, result.SourceZoneID, result.TargetZoneID, mode)
+	for _, c := range result.Changes {
+		fmt.Printf("  %-7s %s %s ttl=%d %s\n", c.Action, c.Name, c.Type, c.TTL, strings.Join(c.Values, ", "))
+		if c.Action == dns.MigrationUpdate {
+			fmt.Printf("          currently %s\n", strings.Join(c.Current, ", "))
+		}
+	}
+	fmt.Printf("records re-pointed: %d, mirror targets re-pointed: %d\n", len(result.Records), len(result.Targets))
+	if len(result.Nameservers) > 0 {
+		fmt.Printf("nameservers: %s\n", strings.Join(result.Nameservers, ", "))
+	}
+	for _, c := range result.Checks {
+		state := "ok"
+		if !c.Verified {
+			state = "FAILED"
+		}
+		fmt.Printf("  verify  %s %s %s (expected %s)\n", c.Domain, c.Type, state, strings.Join(c.Expected, ", "))
+	}
+}
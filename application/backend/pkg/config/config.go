@@ -16,10 +16,15 @@ type ServerConfig struct {
 }
 
 type ServiceConfig struct {
-	LogLevel   int8     `usage:"(0 = debug, 1 = info, 2 = warn, 3 = error, 4 = fatal, 5 = panic)" json:"log_level"`
-	WebPort    uint16   `usage:"Port of the web server to listen on" json:"web_port"`
-	Refresh    string   `usage:"Refresh interval in cron format (e.g. @every minute)" json:"refresh_interval"`
-	DNSServers []string `usage:"DNS servers to use for lookups, e.g. [\"9.9.9.9:53\", \"1.1.1.1:53\"]" json:"dns_servers"`
+	LogLevel   int8            `usage:"(0 = debug, 1 = info, 2 = warn, 3 = error, 4 = fatal, 5 = panic)" json:"log_level"`
+	WebPort    uint16          `usage:"Port of the web server to listen on" json:"web_port"`
+	Refresh    string          `usage:"Refresh interval in cron format (e.g. @every minute)" json:"refresh_interval"`
+	DNSServers []string        `usage:"DNS servers to use for lookups, e.g. [\"9.9.9.9:53\", \"1.1.1.1:53\"]" json:"dns_servers"`
+	Sources    []AddressSource `usage:"Sources used to detect the public address, tried in order until one succeeds" json:"address_sources"`
+	Quorum     int             `usage:"Number of address sources that have to agree on the public address, all sources are queried in parallel when greater than 1" json:"quorum"`
+	Resolvers  []Resolver      `usage:"IP echo services asked by the http address source, tried in order" json:"resolvers"`
+	Watch      string          `usage:"Network interface whose new addresses trigger an immediate refresh on Linux, e.g. ppp0, the interface of an interface source when empty, the interfaces of the uplinks are watched as well" json:"watch_interface"`
+	Uplinks    []Uplink        `usage:"Named WAN connections of a multi-WAN site, records without an uplink use the address sources above" json:"uplinks"`
 }
 
 func Init() {
@@ -29,6 +34,8 @@ func Init() {
 			WebPort:    8080,
 			Refresh:    "@every 5m",
 			DNSServers: []string{"9.9.9.9:53", "1.1.1.1:53", "8.8.8.8:53"},
+			Sources:    []AddressSource{{Type: SourceHTTP}},
+			Resolvers:  DefaultResolvers(),
 		},
 		Database: database.Config{
 			Driver:   "sqlite",
@@ -139,5 +146,32 @@ func (c ServiceConfig) Validate() error {
 		}
 	}
 
+	if c.Quorum < 0 {
+		return apperror.NewError("quorum cannot be negative")
+	}
+
+	for _, resolver := range c.Resolvers {
+		if err := resolver.Validate(); err != nil {
+			return apperror.Wrap(err)
+		}
+	}
+
+	for i, source := range c.Sources {
+		if err := source.Validate(); err != nil {
+			return apperror.NewErrorf("address source %d is invalid", i+1).AddError(err)
+		}
+	}
+
+	names := map[string]bool{}
+	for i, uplink := range c.Uplinks {
+		if err := uplink.Validate(); err != nil {
+			return apperror.NewErrorf("uplink %d is invalid", i+1).AddError(err)
+		}
+		if names[uplink.Name] {
+			return apperror.NewErrorf("uplink %s is configured twice", uplink.Name)
+		}
+		names[uplink.Name] = true
+	}
+
 	return nil
 }
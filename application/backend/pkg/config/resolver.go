@@ -0,0 +1,74 @@
+package config
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+)
+
+const (
+	// ParsePlain takes the whole trimmed response body as the address
+	ParsePlain = "plain"
+	// ParseRegex takes the first capture group, or the whole match, of a regular expression
+	ParseRegex = "regex"
+	// ParseJSON takes the value at a JSON path such as .ip
+	ParseJSON = "json"
+)
+
+// Resolver configures an HTTP IP echo service
+type Resolver struct {
+	URL     string            `usage:"URL of the IP echo service" json:"url"`
+	Method  string            `usage:"HTTP method of the request, GET when empty" json:"method,omitempty"`
+	Headers map[string]string `usage:"Additional request headers" json:"headers,omitempty"`
+	Timeout int               `usage:"Timeout of the request in seconds, 10 when 0" json:"timeout,omitempty"`
+	Parse   string            `usage:"How the address is read from the response (plain, regex, json), plain when empty" json:"parse,omitempty"`
+	Pattern string            `usage:"Regular expression for regex or path like .ip for json" json:"pattern,omitempty"`
+}
+
+// DefaultResolvers are the public IP echo services used when none are configured
+func DefaultResolvers() []Resolver {
+	return []Resolver{
+		{URL: "https://nms.intellitrend.de"},
+		{URL: "https://api64.ipify.org"},
+		{URL: "https://api.my-ip.io/ip"},
+		{URL: "https://api.ipy.ch"},
+		{URL: "https://ident.me/"},
+		{URL: "https://ifconfig.me/ip"},
+		{URL: "https://icanhazip.com/"},
+	}
+}
+
+func (r Resolver) Validate() error {
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return apperror.NewErrorf("invalid resolver URL %q", r.URL)
+	}
+
+	switch strings.ToUpper(r.Method) {
+	case "", http.MethodGet, http.MethodPost, http.MethodHead:
+	default:
+		return apperror.NewErrorf("unsupported HTTP method %q for resolver %s", r.Method, r.URL)
+	}
+
+	if r.Timeout < 0 {
+		return apperror.NewErrorf("timeout of resolver %s cannot be negative", r.URL)
+	}
+
+	switch r.Parse {
+	case "", ParsePlain:
+	case ParseRegex:
+		if _, err := regexp.Compile(r.Pattern); err != nil || r.Pattern == "" {
+			return apperror.NewErrorf("invalid regular expression %q for resolver %s", r.Pattern, r.URL)
+		}
+	case ParseJSON:
+		if !strings.HasPrefix(r.Pattern, ".") {
+			return apperror.NewErrorf("invalid JSON path %q for resolver %s, use a path like .ip", r.Pattern, r.URL)
+		}
+	default:
+		return apperror.NewErrorf("unknown parse mode %q for resolver %s", r.Parse, r.URL)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+)
+
+const (
+	// SourceHTTP asks public IP echo services for the address
+	SourceHTTP = "http"
+	// SourceInterface reads the address from a local network interface
+	SourceInterface = "interface"
+	// SourceUPnP asks an UPnP internet gateway device for its external address
+	SourceUPnP = "upnp"
+	// SourceTR064 asks a FRITZ!Box for its external address over TR-064
+	SourceTR064 = "tr064"
+	// SourceSTUN sends STUN binding requests and reads the mapped address
+	SourceSTUN = "stun"
+	// SourceDNS queries a DNS server that answers with the address of the client
+	SourceDNS = "dns"
+	// SourceCommand runs an executable and reads the address from its output
+	SourceCommand = "command"
+	// SourceHCloud reads the address of a Hetzner Cloud server, Floating IP or Primary IP
+	SourceHCloud = "hcloud"
+)
+
+const (
+	// HCloudServer reads the public address of a server
+	HCloudServer = "server"
+	// HCloudFloatingIP reads the address of a Floating IP
+	HCloudFloatingIP = "floating_ip"
+	// HCloudPrimaryIP reads the address of a Primary IP
+	HCloudPrimaryIP = "primary_ip"
+)
+
+// AddressSource configures one way of detecting the public address
+type AddressSource struct {
+	Type      string   `usage:"Type of the source (http, interface, upnp, tr064, stun, dns, command, hcloud)" json:"type"`
+	Interface string   `usage:"Name of the network interface for the interface source, e.g. ppp0" json:"interface,omitempty"`
+	URL       string   `usage:"Device description URL of the router, discovered via SSDP for upnp when empty, or the API endpoint for hcloud" json:"url,omitempty"`
+	Username  string   `usage:"Username for routers that require authentication" json:"username,omitempty"`
+	Password  string   `usage:"Password for routers that require authentication" json:"password,omitempty"`
+	Servers   []string `usage:"Servers queried by the stun and dns sources as host:port, tried in order" json:"servers,omitempty"`
+	Query     string   `usage:"Name the dns source looks up, e.g. myip.opendns.com" json:"query,omitempty"`
+	QueryType string   `usage:"Record type of the dns source query, A or AAAA by address family when empty or TXT" json:"query_type,omitempty"`
+	Command   string   `usage:"Executable run by the command source, it prints the address or a JSON object with family and address" json:"command,omitempty"`
+	Args      []string `usage:"Arguments passed to the executable of the command source" json:"args,omitempty"`
+	Timeout   int      `usage:"Timeout of the command source in seconds, 10 when 0" json:"timeout,omitempty"`
+	Token     string   `usage:"API token of the Hetzner Cloud project for the hcloud source" json:"token,omitempty"`
+	Resource  string   `usage:"Resource the hcloud source reads the address of (server, floating_ip, primary_ip), server when empty" json:"resource,omitempty"`
+	Name      string   `usage:"Name of the server, Floating IP or Primary IP for the hcloud source" json:"name,omitempty"`
+	Selector  string   `usage:"Label selector of the server, Floating IP or Primary IP for the hcloud source, e.g. role=gateway" json:"selector,omitempty"`
+}
+
+func (s AddressSource) Validate() error {
+	switch s.Type {
+	case SourceHTTP, SourceUPnP, SourceTR064, SourceSTUN:
+	case SourceDNS:
+		if s.QueryType != "" && !strings.EqualFold(s.QueryType, "TXT") {
+			return apperror.NewErrorf("unsupported query type %q for the dns source, use TXT or leave it empty", s.QueryType)
+		}
+	case SourceCommand:
+		if s.Command == "" {
+			return apperror.NewError("command is required for the command source")
+		}
+		if s.Timeout < 0 {
+			return apperror.NewError("timeout of the command source cannot be negative")
+		}
+	case SourceHCloud:
+		if s.Token == "" {
+			return apperror.NewError("API token is required for the hcloud source")
+		}
+		if s.Name == "" && s.Selector == "" {
+			return apperror.NewError("name or label selector is required for the hcloud source")
+		}
+		switch s.Resource {
+		case "", HCloudServer, HCloudFloatingIP, HCloudPrimaryIP:
+		default:
+			return apperror.NewErrorf("unknown hcloud resource %q, use server, floating_ip or primary_ip", s.Resource)
+		}
+	case SourceInterface:
+		if s.Interface == "" {
+			return apperror.NewError("interface name is required for the interface source")
+		}
+	default:
+		return apperror.NewErrorf("unknown address source type %q", s.Type)
+	}
+	return nil
+}
+
+// CommandSources returns the command sources of all uplinks, they run executables and can only be changed in the configuration file
+func (c ServiceConfig) CommandSources() []AddressSource {
+	commands := []AddressSource{}
+	all := slices.Clone(c.Sources)
+	for _, u := range c.Uplinks {
+		all = append(all, u.Sources...)
+	}
+	for _, s := range all {
+		if s.Type == SourceCommand {
+			commands = append(commands, s)
+		}
+	}
+	return commands
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"net"
+	"strings"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+)
+
+// Uplink is a named WAN connection of a multi-WAN site with its own address sources and current addresses
+// The probes of its sources leave through the interface or local addresses instead of the default route
+type Uplink struct {
+	Name           string          `usage:"Name of the uplink records refer to, e.g. wan1" json:"name"`
+	Interface      string          `usage:"Network interface the probes are bound to, e.g. ppp1, on other systems than Linux its address is used as the local address" json:"interface,omitempty"`
+	LocalAddresses []string        `usage:"Local addresses the probes are sent from, one per address family, for source based routing" json:"local_addresses,omitempty"`
+	Sources        []AddressSource `usage:"Sources used to detect the public address of the uplink, the HTTP resolvers when empty" json:"address_sources,omitempty"`
+}
+
+func (u Uplink) Validate() error {
+	if strings.TrimSpace(u.Name) == "" {
+		return apperror.NewError("name is required")
+	}
+	if strings.ContainsAny(u.Name, " /") {
+		return apperror.NewErrorf("name %q cannot contain spaces or slashes", u.Name)
+	}
+	// Without either the probes would leave through the default route and report the address of another uplink
+	if strings.TrimSpace(u.Interface) == "" && len(u.LocalAddresses) == 0 {
+		return apperror.NewErrorf("uplink %s needs an interface or local addresses", u.Name)
+	}
+	for _, local := range u.LocalAddresses {
+		if net.ParseIP(local) == nil {
+			return apperror.NewErrorf("local address %q is not an IP address", local)
+		}
+	}
+	for i, source := range u.Sources {
+		if err := source.Validate(); err != nil {
+			return apperror.NewErrorf("address source %d is invalid", i+1).AddError(err)
+		}
+	}
+	return nil
+}
+
+// Uplink returns the uplink with the given name
+func (c ServiceConfig) Uplink(name string) (Uplink, bool) {
+	for _, u := range c.Uplinks {
+		if u.Name == name {
+			return u, true
+		}
+	}
+	return Uplink{}, false
+}
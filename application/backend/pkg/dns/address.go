@@ -1,47 +1,111 @@
 package dns
 
 import (
+	"context"
+	"encoding/json"
 	"io"
 	"net"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Valentin-Kaiser/go-core/apperror"
 	"github.com/Valentin-Kaiser/go-core/database"
 	"github.com/Valentin-Kaiser/go-core/version"
+	"github.com/Valentin-Kaiser/hdns/pkg/config"
 	"github.com/Valentin-Kaiser/hdns/pkg/model"
 	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 )
 
+func init() {
+	RegisterSource(config.SourceHTTP, func(_ config.AddressSource) (Source, error) {
+		return &httpSource{}, nil
+	})
+}
+
 var (
-	resolvers = []string{
-		"https://nms.intellitrend.de",
-		"https://api.ipify.org",
-		"https://api.my-ip.io/ip",
-		"https://api.ipy.ch",
-		"https://ident.me/",
-		"https://ifconfig.me/ip",
-		"https://icanhazip.com/",
+	clients = map[string]*http.Client{
+		model.FamilyIPv4: newClient("tcp4", &net.Dialer{Timeout: 10 * time.Second}),
+		model.FamilyIPv6: newClient("tcp6", &net.Dialer{Timeout: 10 * time.Second}),
 	}
 )
 
-func UpdateAddress() (*model.Address, error) {
-	ip, err := getPublicIP()
+// Addresses holds the current address of every detected family
+type Addresses map[string]*model.Address
+
+// ForType returns the address published by a DNS record type
+func (a Addresses) ForType(recordType string) (*model.Address, error) {
+	addr, ok := a[model.FamilyOf(recordType)]
+	if !ok || addr == nil {
+		return nil, apperror.NewErrorf("no current %s address detected for the %s record", model.FamilyOf(recordType), recordType)
+	}
+	return addr, nil
+}
+
+// UpdateAddresses detects the public address of all given families on the uplink and marks them as current
+// A family that cannot be detected is skipped, an error is only returned if no family was detected
+func UpdateAddresses(uplink string, families ...string) (Addresses, error) {
+	link, err := findUplink(uplink)
 	if err != nil {
 		return nil, apperror.Wrap(err)
 	}
+	addrs := Addresses{}
+	failures := apperror.NewErrorf("failed to resolve any public IP address of the %s", link)
+	for _, family := range families {
+		addr, err := updateAddress(link, family)
+		if err != nil {
+			failures.AddError(err)
+			continue
+		}
+		addrs[family] = addr
+	}
+	if len(addrs) == 0 {
+		return nil, failures
+	}
+	return addrs, nil
+}
+
+// UpdateAddress detects the public address of a family on the uplink and marks it as the current one of that family
+func UpdateAddress(uplink string, family string) (*model.Address, error) {
+	link, err := findUplink(uplink)
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
+	return updateAddress(link, family)
+}
+
+// updateAddress keeps a history of addresses per uplink, the same address seen on two uplinks is stored twice
+func updateAddress(link *uplink, family string) (*model.Address, error) {
+	ip, err := getPublicIP(link, family)
+	if err != nil {
+		// Behind a carrier-grade NAT the router only knows the shared address, the status is recorded on the address the internet sees
+		public, wan := behindCGNAT(link, family)
+		if wan == "" {
+			return nil, apperror.Wrap(err)
+		}
+		if public == "" {
+			return nil, apperror.NewErrorf("the WAN address %s of the %s belongs to a carrier-grade NAT and no external service reported the public %s address", wan, link, family).AddError(err)
+		}
+		log.Warn().Msgf("[DNS] the WAN address %s of the %s belongs to a carrier-grade NAT, using the address %s external services see", wan, link, public)
+		ip = public
+	}
 	addr := &model.Address{
-		IP: ip,
+		IP:     ip,
+		Family: family,
+		Uplink: link.name,
 	}
 	err = database.Execute(func(db *gorm.DB) error {
-		return db.FirstOrCreate(&addr, model.Address{IP: ip}).Error
+		// A map condition keeps the empty name of the default uplink, a struct condition would skip it
+		return db.Where(map[string]any{"ip": ip, "family": family, "uplink": link.name}).FirstOrCreate(&addr).Error
 	})
 	if err != nil {
 		return nil, apperror.NewError("failed to save public IP address to database").AddError(err)
 	}
 	err = database.Execute(func(db *gorm.DB) error {
-		err := db.Model(&model.Address{}).Where("current = ?", true).Update("current", false).Error
+		err := db.Model(&model.Address{}).Where("current = ? AND family = ? AND uplink = ?", true, family, link.name).Update("current", false).Error
 		if err != nil {
 			return apperror.NewError("failed to update current address in database").AddError(err)
 		}
@@ -51,43 +115,247 @@ func UpdateAddress() (*model.Address, error) {
 	if err != nil {
 		return nil, apperror.NewError("failed to update current address in database").AddError(err)
 	}
+	updateNAT(link, addr)
 	return addr, nil
 }
 
-func getPublicIP() (string, error) {
-	for _, r := range resolvers {
-		addr, err := resolveIPAddress(r)
+// CurrentAddresses loads the current address of every family on the uplink from the database
+func CurrentAddresses(uplink string) (Addresses, error) {
+	var current []*model.Address
+	err := database.Execute(func(db *gorm.DB) error {
+		return db.Where("current = ? AND uplink = ?", true, uplink).Find(&current).Error
+	})
+	if err != nil {
+		return nil, apperror.NewError("failed to load current addresses").AddError(err)
+	}
+	addrs := Addresses{}
+	for _, addr := range current {
+		addrs[addr.Family] = addr
+	}
+	return addrs, nil
+}
+
+func getPublicIP(link *uplink, family string) (string, error) {
+	if quorum := config.Get().Service.Quorum; quorum > 1 {
+		return consensus(link, family, quorum)
+	}
+	for _, c := range link.sources {
+		source, err := link.newSource(c)
 		if err != nil {
-			log.Error().Err(err).Msgf("resolver %s failed", r)
+			log.Error().Err(err).Msgf("address source %s is invalid", c.Type)
 			continue
 		}
-		log.Info().Msgf("[DNS] resolved public IP: %s using resolver %s", addr, r)
+		addr, err := source.Address(family)
+		if err != nil {
+			log.Error().Err(err).Msgf("address source %s failed", source)
+			continue
+		}
+		log.Info().Msgf("[DNS] resolved public IP: %s using %s on the %s", addr, source, link)
 		return addr, nil
 	}
-	return "", apperror.NewError("failed to resolve public IP address using all resolvers")
+	return "", apperror.NewErrorf("failed to resolve public %s address of the %s using all sources", family, link)
+}
+
+// httpSource asks the public IP echo services one after another
+type httpSource struct {
+	link *uplink
+}
+
+func (s *httpSource) String() string {
+	return "http resolvers"
+}
+
+func (s *httpSource) bind(link *uplink) Source {
+	return &httpSource{link: link}
+}
+
+func (s *httpSource) Address(family string) (string, error) {
+	// Reliable resolvers are asked first, those failing repeatedly are skipped during their cool-down unless no other is left
+	ranked := rank(model.HealthResolver, family, configuredResolvers(), func(r config.Resolver) string { return s.link.healthName(r.URL) })
+	for _, r := range ranked {
+		addr, err := resolveIPAddress(s.link, r, family)
+		if err != nil {
+			log.Error().Err(err).Msgf("resolver %s failed", r.URL)
+			continue
+		}
+		log.Debug().Msgf("[DNS] resolver %s answered with %s", r.URL, addr)
+		return addr, nil
+	}
+	return "", apperror.NewErrorf("failed to resolve public %s address using all resolvers", family)
+}
+
+// Split returns every resolver as its own source so each one gets a vote
+func (s *httpSource) Split() []Source {
+	configured := configuredResolvers()
+	split := make([]Source, 0, len(configured))
+	for _, r := range configured {
+		split = append(split, &httpResolverSource{resolver: r, link: s.link})
+	}
+	return split
 }
 
-func resolveIPAddress(url string) (string, error) {
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+// httpResolverSource asks a single public IP echo service
+type httpResolverSource struct {
+	resolver config.Resolver
+	link     *uplink
+}
+
+func (s *httpResolverSource) String() string {
+	return "http " + s.resolver.URL
+}
+
+func (s *httpResolverSource) Address(family string) (string, error) {
+	return resolveIPAddress(s.link, s.resolver, family)
+}
+
+// configuredResolvers returns the configured IP echo services, the default ones if none are configured
+func configuredResolvers() []config.Resolver {
+	configured := config.Get().Service.Resolvers
+	if len(configured) == 0 {
+		return config.DefaultResolvers()
+	}
+	return configured
+}
+
+// resolveIPAddress asks an IP echo service through the uplink and records how it performed
+func resolveIPAddress(link *uplink, r config.Resolver, family string) (string, error) {
+	client, err := link.client(family)
 	if err != nil {
-		return "", apperror.NewErrorf("failed to create request for %s", url).AddError(err)
+		return "", apperror.Wrap(err)
+	}
+	start := time.Now()
+	addr, err := fetchIPAddress(client, r, family)
+	observe(model.HealthResolver, family, link.healthName(r.URL), time.Since(start), err)
+	return addr, err
+}
+
+func fetchIPAddress(client *http.Client, r config.Resolver, family string) (string, error) {
+	timeout := time.Duration(r.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	method := strings.ToUpper(r.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.URL, nil)
+	if err != nil {
+		return "", apperror.NewErrorf("failed to create request for %s", r.URL).AddError(err)
 	}
 	req.Header.Set("User-Agent", "hdns/"+version.GitTag)
+	for k, v := range r.Headers {
+		req.Header.Set(k, v)
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
-		return "", apperror.NewErrorf("failed to get public IP from %s", url).AddError(err)
+		return "", apperror.NewErrorf("failed to get public IP from %s", r.URL).AddError(err)
 	}
 	defer apperror.Catch(resp.Body.Close, "failed to close response body")
-	bytes, err := io.ReadAll(io.LimitReader(resp.Body, 15))
+	if resp.StatusCode != http.StatusOK {
+		return "", apperror.NewErrorf("resolver %s answered with status %d: %s", r.URL, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", apperror.NewErrorf("failed to read response from %s", r.URL).AddError(err)
+	}
+	candidates, err := extractAddresses(r, body)
 	if err != nil {
-		return "", apperror.NewErrorf("failed to read response from %s", url).AddError(err)
+		return "", apperror.NewErrorf("failed to parse response from %s", r.URL).AddError(err)
 	}
-	addr := strings.TrimSpace(string(bytes))
-	if !ValidateAddress(addr) {
-		return "", apperror.NewErrorf("invalid IP address %s from %s", addr, url)
+	for _, addr := range candidates {
+		if ValidateAddress(addr) && Family(addr) == family {
+			return addr, nil
+		}
 	}
-	return addr, nil
+	return "", apperror.NewErrorf("no valid %s address in the response from %s", family, r.URL)
+}
+
+// extractAddresses reads the candidate addresses from a response body as configured by the parse mode of the resolver
+func extractAddresses(r config.Resolver, body []byte) ([]string, error) {
+	switch r.Parse {
+	case config.ParseRegex:
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, apperror.NewErrorf("invalid regular expression %q", r.Pattern).AddError(err)
+		}
+		candidates := []string{}
+		for _, match := range re.FindAllStringSubmatch(string(body), -1) {
+			value := match[0]
+			if len(match) > 1 {
+				value = match[1]
+			}
+			candidates = append(candidates, strings.TrimSpace(value))
+		}
+		return candidates, nil
+	case config.ParseJSON:
+		var doc interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return nil, apperror.NewError("response is not valid JSON").AddError(err)
+		}
+		value, err := jsonPath(doc, r.Pattern)
+		if err != nil {
+			return nil, apperror.Wrap(err)
+		}
+		addr, ok := value.(string)
+		if !ok {
+			return nil, apperror.NewErrorf("value at %s is not a string", r.Pattern)
+		}
+		return []string{strings.TrimSpace(addr)}, nil
+	}
+	return []string{strings.TrimSpace(string(body))}, nil
+}
+
+// jsonPath walks a decoded JSON document along a path like .ip or .data.addresses[0]
+func jsonPath(doc interface{}, path string) (interface{}, error) {
+	for _, part := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+		key, index, hasIndex := strings.Cut(part, "[")
+		if key != "" {
+			obj, ok := doc.(map[string]interface{})
+			if !ok {
+				return nil, apperror.NewErrorf("cannot read %q of a non object at %s", key, path)
+			}
+			doc, ok = obj[key]
+			if !ok {
+				return nil, apperror.NewErrorf("key %q not found at %s", key, path)
+			}
+		}
+		if !hasIndex {
+			continue
+		}
+		i, err := strconv.Atoi(strings.TrimSuffix(index, "]"))
+		if err != nil {
+			return nil, apperror.NewErrorf("invalid array index in %s", path).AddError(err)
+		}
+		arr, ok := doc.([]interface{})
+		if !ok || i < 0 || i >= len(arr) {
+			return nil, apperror.NewErrorf("index %d out of range at %s", i, path)
+		}
+		doc = arr[i]
+	}
+	return doc, nil
+}
+
+// newClient creates an HTTP client that only connects over the given network, tcp4 or tcp6
+// The resolvers answer with the address the request came from, so the network decides the family that is detected
+func newClient(network string, dialer *net.Dialer) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, _, address string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, address)
+	}
+	return &http.Client{Transport: transport, Timeout: 30 * time.Second}
+}
+
+// Family returns the address family of an IP address
+func Family(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr != nil && addr.To4() == nil {
+		return model.FamilyIPv6
+	}
+	return model.FamilyIPv4
 }
 
 func ValidateAddress(ip string) bool {
@@ -107,7 +375,11 @@ func ValidateAddress(ip string) bool {
 	if addr.IsMulticast() {
 		return false
 	}
-	if addr.To4() == nil {
+	if addr.IsLinkLocalUnicast() {
+		return false
+	}
+	// Addresses of a carrier-grade NAT are shared by many customers and not reachable from the internet
+	if cgnatRange.Contains(addr) {
 		return false
 	}
 	return true
@@ -0,0 +1,27 @@
+package dns
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+)
+
+// bindInterface sends the connections of the dialer through the network interface regardless of the routing table
+// Binding to a device needs CAP_NET_RAW on kernels before 5.7
+func bindInterface(d *net.Dialer, name, _ string) error {
+	d.Control = func(_, _ string, c syscall.RawConn) error {
+		var bindErr error
+		err := c.Control(func(fd uintptr) {
+			bindErr = syscall.BindToDevice(int(fd), name)
+		})
+		if err != nil {
+			return apperror.Wrap(err)
+		}
+		if bindErr != nil {
+			return apperror.NewErrorf("failed to bind to network interface %s", name).AddError(bindErr)
+		}
+		return nil
+	}
+	return nil
+}
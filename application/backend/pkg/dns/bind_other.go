@@ -0,0 +1,37 @@
+//go:build !linux
+
+package dns
+
+import (
+	"net"
+	"strings"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+)
+
+// bindInterface sends the connections of the dialer from an address of the network interface
+// Other systems than Linux cannot bind to a device, the address only selects the uplink with source based routing
+func bindInterface(d *net.Dialer, name, network string) error {
+	if d.LocalAddr != nil {
+		return nil
+	}
+	family := model.FamilyIPv4
+	if strings.HasSuffix(network, "6") {
+		family = model.FamilyIPv6
+	}
+	addrs, err := (&interfaceSource{name: name}).addresses(family)
+	if err != nil {
+		return apperror.Wrap(err)
+	}
+	if len(addrs) == 0 {
+		return apperror.NewErrorf("network interface %s has no %s address to bind to", name, family)
+	}
+	ip := net.ParseIP(addrs[0])
+	if strings.HasPrefix(network, "udp") {
+		d.LocalAddr = &net.UDPAddr{IP: ip}
+	} else {
+		d.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/go-core/version"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	cloudflareBaseURL = "https://api.cloudflare.com/client/v4"
+	// cloudflareAutoTTL lets Cloudflare choose the TTL
+	cloudflareAutoTTL = 1
+)
+
+func init() {
+	RegisterProvider("cloudflare", func(c model.Credential) (Provider, error) {
+		baseURL := cloudflareBaseURL
+		if c.Endpoint != "" {
+			baseURL = strings.TrimSuffix(c.Endpoint, "/")
+		}
+		return &cloudflare{baseURL: baseURL, APIToken: c.Token.String()}, nil
+	})
+}
+
+// cloudflare talks to the Cloudflare API v4 using an API token
+type cloudflare struct {
+	baseURL  string
+	APIToken string
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     uint32 `json:"ttl"`
+	Proxied bool   `json:"proxied"`
+}
+
+type cloudflareResponse struct {
+	Success bool            `json:"success"`
+	Errors  []cloudflareErr `json:"errors"`
+	Result  json.RawMessage `json:"result"`
+	Info    struct {
+		Page       int `json:"page"`
+		TotalPages int `json:"total_pages"`
+	} `json:"result_info"`
+}
+
+type cloudflareErr struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (c *cloudflare) Zones() ([]Zone, error) {
+	zones := []Zone{}
+	for page, pages := 1, 1; page <= pages; page++ {
+		res, err := c.fetch(http.MethodGet, fmt.Sprintf("%s/zones?page=%d&per_page=50", c.baseURL, page), nil)
+		if err != nil {
+			return nil, apperror.Wrap(err)
+		}
+
+		var result []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(res.Result, &result); err != nil {
+			return nil, apperror.NewError("unmarshal response failed").AddError(err)
+		}
+		for _, z := range result {
+			zones = append(zones, Zone{ID: z.ID, Name: z.Name})
+		}
+		pages = res.Info.TotalPages
+	}
+	return zones, nil
+}
+
+func (c *cloudflare) FindRecord(zone Zone, name, recordType string) (*Record, bool, error) {
+	query := url.Values{}
+	query.Set("type", recordType)
+	query.Set("name", recordFQDN(zone, name))
+	res, err := c.fetch(http.MethodGet, fmt.Sprintf("%s/zones/%s/dns_records?%s", c.baseURL, url.PathEscape(zone.ID), query.Encode()), nil)
+	if err != nil {
+		return nil, false, apperror.Wrap(err)
+	}
+
+	var result []cloudflareRecord
+	if err := json.Unmarshal(res.Result, &result); err != nil {
+		return nil, false, apperror.NewError("unmarshal response failed").AddError(err)
+	}
+	switch len(result) {
+	case 0:
+		return nil, false, nil
+	case 1:
+		return c.fromCloudflare(zone, result[0]), true, nil
+	}
+	return nil, false, apperror.NewErrorf("found %d %s records named %s, remove the duplicates at the provider", len(result), recordType, recordFQDN(zone, name))
+}
+
+// GetRecord fetches a record by its ID
+func (c *cloudflare) GetRecord(zone Zone, id string) (*Record, bool, error) {
+	status, body, err := c.request(http.MethodGet, fmt.Sprintf("%s/zones/%s/dns_records/%s", c.baseURL, url.PathEscape(zone.ID), url.PathEscape(id)), nil)
+	if err != nil {
+		return nil, false, apperror.Wrap(err)
+	}
+	if status == http.StatusNotFound {
+		return nil, false, nil
+	}
+	res, err := c.parse(status, body)
+	if err != nil {
+		return nil, false, apperror.Wrap(err)
+	}
+
+	var result cloudflareRecord
+	if err := json.Unmarshal(res.Result, &result); err != nil {
+		return nil, false, apperror.NewError("unmarshal response failed").AddError(err)
+	}
+	return c.fromCloudflare(zone, result), true, nil
+}
+
+func (c *cloudflare) CreateRecord(zone Zone, record *Record) error {
+	if err := validateRecord(record); err != nil {
+		return err
+	}
+	data, err := json.Marshal(c.toCloudflare(zone, record))
+	if err != nil {
+		return apperror.NewError("marshaling the create record failed").AddError(err)
+	}
+	res, err := c.fetch(http.MethodPost, fmt.Sprintf("%s/zones/%s/dns_records", c.baseURL, url.PathEscape(zone.ID)), data)
+	if err != nil {
+		return apperror.NewError("creating the record failed").AddError(err)
+	}
+
+	var result cloudflareRecord
+	if err := json.Unmarshal(res.Result, &result); err != nil {
+		return apperror.NewError("unmarshal response for create action failed").AddError(err)
+	}
+	record.ID = result.ID
+	return nil
+}
+
+func (c *cloudflare) UpdateRecord(zone Zone, record *Record) error {
+	data, err := json.Marshal(c.toCloudflare(zone, record))
+	if err != nil {
+		return apperror.NewError("marshaling the update record failed").AddError(err)
+	}
+	_, err = c.fetch(http.MethodPut, fmt.Sprintf("%s/zones/%s/dns_records/%s", c.baseURL, url.PathEscape(zone.ID), url.PathEscape(record.ID)), data)
+	if err != nil {
+		return apperror.NewError("updating the record failed").AddError(err)
+	}
+	return nil
+}
+
+func (c *cloudflare) DeleteRecord(zone Zone, record *Record) error {
+	_, err := c.fetch(http.MethodDelete, fmt.Sprintf("%s/zones/%s/dns_records/%s", c.baseURL, url.PathEscape(zone.ID), url.PathEscape(record.ID)), nil)
+	if err != nil {
+		return apperror.NewError("deleting the record failed").AddError(err)
+	}
+	return nil
+}
+
+func (c *cloudflare) toCloudflare(zone Zone, record *Record) cloudflareRecord {
+	ttl := record.TTL
+	if ttl == 0 || record.Proxied {
+		ttl = cloudflareAutoTTL
+	}
+	return cloudflareRecord{
+		Type:    record.Type,
+		Name:    recordFQDN(zone, record.Name),
+		Content: record.Value,
+		TTL:     ttl,
+		Proxied: record.Proxied,
+	}
+}
+
+// fromCloudflare converts a Cloudflare record into a record with a name relative to its zone
+func (c *cloudflare) fromCloudflare(zone Zone, r cloudflareRecord) *Record {
+	name := r.Name
+	domain := recordFQDN(zone, "@")
+	switch {
+	case strings.EqualFold(name, domain):
+		name = "@"
+	case strings.HasSuffix(strings.ToLower(name), "."+strings.ToLower(domain)):
+		name = name[:len(name)-len(domain)-1]
+	}
+	return &Record{
+		ID:      r.ID,
+		ZoneID:  zone.ID,
+		Type:    r.Type,
+		Name:    name,
+		Value:   r.Content,
+		Values:  []string{r.Content},
+		TTL:     r.TTL,
+		Proxied: r.Proxied,
+	}
+}
+
+func (c *cloudflare) fetch(method, url string, body []byte) (*cloudflareResponse, error) {
+	status, body, err := c.request(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.parse(status, body)
+}
+
+// request sends a request to the API and returns the status code and body without interpreting them
+func (c *cloudflare) request(method, url string, body []byte) (int, []byte, error) {
+	log.Trace().Str("url", url).Str("method", method).Str("body", string(body)).Msg("HTTP request")
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, apperror.NewError("creating HTTP request failed").AddError(err)
+	}
+	req.Header.Set("User-Agent", "hdns/"+version.GitTag)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.APIToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, apperror.NewError("sending HTTP request failed").AddError(err)
+	}
+	defer apperror.Catch(resp.Body.Close, "failed to close response body")
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, apperror.NewError("reading response body failed").AddError(err)
+	}
+	log.Trace().Str("body", string(body)).Msg("HTTP response")
+	return resp.StatusCode, body, nil
+}
+
+// parse decodes the response envelope and converts unsuccessful responses into an error
+func (c *cloudflare) parse(status int, body []byte) (*cloudflareResponse, error) {
+	var res cloudflareResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, apperror.NewErrorf("HTTP request failed with status %d: %s", status, http.StatusText(status)).AddError(err)
+	}
+	if !res.Success || status != http.StatusOK {
+		msg := http.StatusText(status)
+		if len(res.Errors) > 0 {
+			msg = fmt.Sprintf("%s (%d)", res.Errors[0].Message, res.Errors[0].Code)
+		}
+		return nil, apperror.NewErrorf("HTTP request failed with status %d: %s", status, msg)
+	}
+	return &res, nil
+}
@@ -0,0 +1,110 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/hdns/pkg/config"
+)
+
+func init() {
+	RegisterSource(config.SourceCommand, func(c config.AddressSource) (Source, error) {
+		if c.Command == "" {
+			return nil, apperror.NewError("command is required")
+		}
+		timeout := time.Duration(c.Timeout) * time.Second
+		if timeout == 0 {
+			timeout = 10 * time.Second
+		}
+		return &commandSource{command: c.Command, args: c.Args, timeout: timeout}, nil
+	})
+}
+
+// commandSource runs an executable for site specific logic, e.g. reading the address from a modem over SSH or SNMP
+// The requested family is passed as HDNS_FAMILY, the output is either the address or JSON like {"family": "ipv4", "address": "..."}
+type commandSource struct {
+	command string
+	args    []string
+	timeout time.Duration
+}
+
+// commandAddress is an address printed as JSON by a command
+type commandAddress struct {
+	Family  string `json:"family"`
+	Address string `json:"address"`
+}
+
+func (s *commandSource) String() string {
+	return "command " + s.command
+}
+
+func (s *commandSource) Address(family string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.command, s.args...)
+	cmd.Env = append(os.Environ(), "HDNS_FAMILY="+family)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Children that inherited the output must not keep the source waiting after the timeout
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", apperror.NewErrorf("command %s did not finish within %s", s.command, s.timeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", apperror.NewErrorf("command %s failed: %s", s.command, msg).AddError(err)
+		}
+		return "", apperror.NewErrorf("command %s failed", s.command).AddError(err)
+	}
+
+	candidates, err := commandAddresses(stdout.Bytes(), family)
+	if err != nil {
+		return "", apperror.NewErrorf("failed to parse the output of command %s", s.command).AddError(err)
+	}
+	for _, addr := range candidates {
+		if ValidateAddress(addr) && Family(addr) == family {
+			return addr, nil
+		}
+	}
+	return "", apperror.NewErrorf("command %s printed no valid %s address", s.command, family)
+}
+
+// commandAddresses reads the addresses from the output, a JSON object or array or one address per line
+// Addresses printed as JSON with another family are skipped
+func commandAddresses(output []byte, family string) ([]string, error) {
+	trimmed := bytes.TrimSpace(output)
+	var printed []commandAddress
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var single commandAddress
+		if err := json.Unmarshal(trimmed, &single); err != nil {
+			return nil, apperror.NewError("invalid JSON object").AddError(err)
+		}
+		printed = append(printed, single)
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		if err := json.Unmarshal(trimmed, &printed); err != nil {
+			return nil, apperror.NewError("invalid JSON array").AddError(err)
+		}
+	default:
+		return strings.Fields(string(trimmed)), nil
+	}
+
+	addrs := []string{}
+	for _, p := range printed {
+		if p.Family != "" && p.Family != family {
+			continue
+		}
+		addrs = append(addrs, strings.TrimSpace(p.Address))
+	}
+	return addrs, nil
+}
@@ -0,0 +1,177 @@
+package dns
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/rs/zerolog/log"
+)
+
+// maxDisagreements limits how many rounds with disagreeing sources are kept
+const maxDisagreements = 50
+
+var (
+	consensusMutex = &sync.RWMutex{}
+	lastRounds     = make(map[string]Round)
+	disagreements  = []Round{}
+)
+
+// Vote is the answer of a single source in a consensus round
+type Vote struct {
+	Source  string `json:"source"`
+	Address string `json:"address,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Round is the outcome of asking all sources of an uplink for the address of a family
+type Round struct {
+	Uplink       string    `json:"uplink,omitempty"`
+	Family       string    `json:"family"`
+	Address      string    `json:"address,omitempty"`
+	Agreed       int       `json:"agreed"`
+	Required     int       `json:"required"`
+	Disagreement bool      `json:"disagreement"`
+	Votes        []Vote    `json:"votes"`
+	Time         time.Time `json:"time"`
+}
+
+// disagrees reports whether the sources that answered named different addresses
+func (r Round) disagrees() bool {
+	seen := ""
+	for _, v := range r.Votes {
+		if v.Address == "" {
+			continue
+		}
+		if seen != "" && v.Address != seen {
+			return true
+		}
+		seen = v.Address
+	}
+	return false
+}
+
+// LastRounds returns the latest consensus round of every uplink and family
+func LastRounds() []Round {
+	consensusMutex.RLock()
+	defer consensusMutex.RUnlock()
+
+	rounds := make([]Round, 0, len(lastRounds))
+	for _, r := range lastRounds {
+		rounds = append(rounds, r)
+	}
+	sort.Slice(rounds, func(i, j int) bool {
+		if rounds[i].Uplink != rounds[j].Uplink {
+			return rounds[i].Uplink < rounds[j].Uplink
+		}
+		return rounds[i].Family < rounds[j].Family
+	})
+	return rounds
+}
+
+// Disagreements returns the latest rounds in which sources named different addresses, newest first
+func Disagreements() []Round {
+	consensusMutex.RLock()
+	defer consensusMutex.RUnlock()
+
+	rounds := slices.Clone(disagreements)
+	slices.Reverse(rounds)
+	return rounds
+}
+
+// consensus asks all sources of the uplink in parallel and accepts the address named by at least quorum of them
+func consensus(link *uplink, family string, quorum int) (string, error) {
+	voters := []Source{}
+	for _, c := range link.sources {
+		source, err := link.newSource(c)
+		if err != nil {
+			log.Error().Err(err).Msgf("address source %s is invalid", c.Type)
+			continue
+		}
+		if split, ok := source.(SplitSource); ok {
+			voters = append(voters, split.Split()...)
+			continue
+		}
+		voters = append(voters, source)
+	}
+	if len(voters) < quorum {
+		return "", apperror.NewErrorf("a quorum of %d needs at least as many address sources, only %d are configured", quorum, len(voters))
+	}
+
+	round := Round{
+		Uplink:   link.name,
+		Family:   family,
+		Required: quorum,
+		Votes:    make([]Vote, len(voters)),
+		Time:     time.Now(),
+	}
+	var wg sync.WaitGroup
+	for i, voter := range voters {
+		wg.Add(1)
+		go func(index int, source Source) {
+			defer wg.Done()
+			vote := Vote{Source: source.String()}
+			addr, err := source.Address(family)
+			if err != nil {
+				vote.Error = err.Error()
+			} else {
+				vote.Address = addr
+			}
+			round.Votes[index] = vote
+		}(i, voter)
+	}
+	wg.Wait()
+
+	counts := map[string]int{}
+	for _, v := range round.Votes {
+		if v.Address != "" {
+			counts[v.Address]++
+		}
+	}
+	tie := false
+	for addr, count := range counts {
+		switch {
+		case count > round.Agreed:
+			round.Address, round.Agreed, tie = addr, count, false
+		case count == round.Agreed:
+			tie = true
+		}
+	}
+	if tie || round.Agreed < quorum {
+		round.Address = ""
+	}
+	keepRound(round)
+
+	if round.Address == "" {
+		return "", apperror.NewErrorf("address sources of the %s did not agree on a public %s address, %d of %d required", link, family, round.Agreed, quorum)
+	}
+	log.Info().Msgf("[DNS] resolved public IP: %s agreed by %d of %d sources on the %s", round.Address, round.Agreed, len(voters), link)
+	return round.Address, nil
+}
+
+// keepRound keeps the round and logs which sources disagreed with the majority
+func keepRound(round Round) {
+	round.Disagreement = round.disagrees()
+	if round.Disagreement {
+		dissent := []string{}
+		for _, v := range round.Votes {
+			if v.Address != "" && v.Address != round.Address {
+				dissent = append(dissent, v.Source+" answered "+v.Address)
+			}
+		}
+		log.Warn().Msgf("[DNS] address sources disagree on the public %s address: %s", round.Family, strings.Join(dissent, ", "))
+	}
+
+	consensusMutex.Lock()
+	defer consensusMutex.Unlock()
+	lastRounds[round.Uplink+"/"+round.Family] = round
+	if round.Disagreement {
+		disagreements = append(disagreements, round)
+		if len(disagreements) > maxDisagreements {
+			disagreements = disagreements[len(disagreements)-maxDisagreements:]
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/hdns/pkg/config"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// dnsSourceServers answer the myip.opendns.com query with the address of the client
+	dnsSourceServers = []string{"resolver1.opendns.com:53", "resolver2.opendns.com:53"}
+	dnsSourceQuery   = "myip.opendns.com"
+	dnsSourceTimeout = 5 * time.Second
+)
+
+func init() {
+	RegisterSource(config.SourceDNS, func(c config.AddressSource) (Source, error) {
+		s := &dnsSource{
+			query: c.Query,
+			txt:   strings.EqualFold(c.QueryType, "TXT"),
+		}
+		if s.query == "" {
+			s.query = dnsSourceQuery
+		}
+		// The query is sent as is, a relative name would be extended by the search domains of the host
+		if !strings.HasSuffix(s.query, ".") {
+			s.query += "."
+		}
+		servers := c.Servers
+		if len(servers) == 0 {
+			servers = dnsSourceServers
+		}
+		for _, server := range servers {
+			if _, _, err := net.SplitHostPort(server); err != nil {
+				server = net.JoinHostPort(server, "53")
+			}
+			s.servers = append(s.servers, server)
+		}
+		return s, nil
+	})
+}
+
+// dnsSource learns the public address from a DNS server that reports the address the query came from
+// e.g. an A or AAAA query for myip.opendns.com against resolver1.opendns.com or
+// a TXT query for o-o.myaddr.l.google.com against ns1.google.com
+type dnsSource struct {
+	servers []string
+	query   string
+	txt     bool
+	link    *uplink
+}
+
+func (s *dnsSource) String() string {
+	return "dns " + strings.TrimSuffix(s.query, ".") + " via " + strings.Join(s.servers, ", ")
+}
+
+func (s *dnsSource) bind(link *uplink) Source {
+	return &dnsSource{servers: s.servers, query: s.query, txt: s.txt, link: link}
+}
+
+func (s *dnsSource) Address(family string) (string, error) {
+	// The query has to reach the server over the requested family, the server answers with the address it saw
+	network, lookup := "udp4", "ip4"
+	if family == model.FamilyIPv6 {
+		network, lookup = "udp6", "ip6"
+	}
+	for _, server := range s.servers {
+		addrs, err := s.lookup(dialResolver(s.link, network, server), lookup)
+		if err != nil {
+			log.Error().Err(err).Msgf("DNS server %s failed to answer %s", server, s.query)
+			continue
+		}
+		for _, addr := range addrs {
+			if ValidateAddress(addr) && Family(addr) == family {
+				return addr, nil
+			}
+		}
+		log.Error().Msgf("DNS server %s answered %s without a valid %s address: %v", server, s.query, family, addrs)
+	}
+	return "", apperror.NewErrorf("failed to resolve public %s address using all DNS servers", family)
+}
+
+// Split returns every server as its own source so each one gets a vote
+func (s *dnsSource) Split() []Source {
+	split := make([]Source, 0, len(s.servers))
+	for _, server := range s.servers {
+		split = append(split, &dnsSource{servers: []string{server}, query: s.query, txt: s.txt, link: s.link})
+	}
+	return split
+}
+
+// lookup returns the candidate addresses of the answer
+func (s *dnsSource) lookup(resolver *net.Resolver, network string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsSourceTimeout)
+	defer cancel()
+
+	if s.txt {
+		values, err := resolver.LookupTXT(ctx, s.query)
+		if err != nil {
+			return nil, apperror.NewErrorf("TXT lookup of %s failed", s.query).AddError(err)
+		}
+		addrs := make([]string, 0, len(values))
+		for _, v := range values {
+			addrs = append(addrs, strings.TrimSpace(v))
+		}
+		return addrs, nil
+	}
+
+	ips, err := resolver.LookupIP(ctx, network, s.query)
+	if err != nil {
+		return nil, apperror.NewErrorf("address lookup of %s failed", s.query).AddError(err)
+	}
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, ip.String())
+	}
+	return addrs, nil
+}
@@ -0,0 +1,34 @@
+package dns
+
+import (
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+)
+
+// followAddresses resolves a hostname against the configured DNS servers, e.g. the vendor DDNS name of a router
+// The first server that answers with an address of a family decides, in the configured order of the servers
+func followAddresses(host string) (Addresses, error) {
+	resolutions, err := NewDNSResolver().Resolve(host)
+	if err != nil {
+		return nil, apperror.NewErrorf("failed to resolve %s", host).AddError(err)
+	}
+
+	addrs := Addresses{}
+	failures := apperror.NewErrorf("failed to resolve %s", host)
+	for _, res := range resolutions {
+		if res.Error != "" {
+			failures.AddError(apperror.NewErrorf("%s: %s", res.Server, res.Error))
+			continue
+		}
+		for _, ip := range res.Addresses {
+			family := Family(ip)
+			if _, ok := addrs[family]; !ok {
+				addrs[family] = &model.Address{IP: ip, Family: family}
+			}
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, failures
+	}
+	return addrs, nil
+}
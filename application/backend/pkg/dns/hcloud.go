@@ -0,0 +1,393 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/go-core/version"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	hetznerCloudBaseURL = "https://api.hetzner.cloud/v1"
+)
+
+func init() {
+	RegisterProvider("hetzner-cloud", func(c model.Credential) (Provider, error) {
+		baseURL := hetznerCloudBaseURL
+		if c.Endpoint != "" {
+			baseURL = strings.TrimSuffix(c.Endpoint, "/")
+		}
+		return &hetznerCloud{baseURL: baseURL, APIToken: c.Token.String()}, nil
+	})
+}
+
+// hetznerCloud talks to the Hetzner Cloud DNS API which manages records as RRSets
+type hetznerCloud struct {
+	baseURL  string
+	APIToken string
+}
+
+type hcloudZone struct {
+	ID                       int64  `json:"id"`
+	Name                     string `json:"name"`
+	RecordCount              int    `json:"record_count"`
+	AuthoritativeNameservers struct {
+		Assigned []string `json:"assigned"`
+	} `json:"authoritative_nameservers"`
+}
+
+type hcloudRRSet struct {
+	ID      string         `json:"id,omitempty"`
+	Name    string         `json:"name"`
+	Type    string         `json:"type"`
+	TTL     *uint32        `json:"ttl,omitempty"`
+	Records []hcloudRecord `json:"records"`
+}
+
+type hcloudRecord struct {
+	Value   string `json:"value"`
+	Comment string `json:"comment,omitempty"`
+}
+
+type hcloudError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (c *hetznerCloud) Zones() ([]Zone, error) {
+	zones := []Zone{}
+	page := 1
+	for page > 0 {
+		body, err := c.fetch(http.MethodGet, fmt.Sprintf("%s/zones?page=%d&per_page=100", c.baseURL, page), nil)
+		if err != nil {
+			return nil, apperror.Wrap(err)
+		}
+
+		var res struct {
+			Zones []hcloudZone `json:"zones"`
+			Meta  struct {
+				Pagination struct {
+					NextPage int `json:"next_page"`
+				} `json:"pagination"`
+			} `json:"meta"`
+		}
+		if err := json.Unmarshal(body, &res); err != nil {
+			return nil, apperror.NewError("unmarshal response failed").AddError(err)
+		}
+
+		for _, z := range res.Zones {
+			zones = append(zones, Zone{
+				ID:           strconv.FormatInt(z.ID, 10),
+				Name:         z.Name,
+				RecordsCount: z.RecordCount,
+			})
+		}
+		page = res.Meta.Pagination.NextPage
+	}
+	return zones, nil
+}
+
+func (c *hetznerCloud) FindRecord(zone Zone, name, recordType string) (*Record, bool, error) {
+	page := 1
+	for page > 0 {
+		query := url.Values{}
+		query.Set("name", name)
+		query.Set("type", recordType)
+		query.Set("page", strconv.Itoa(page))
+		query.Set("per_page", "100")
+		body, err := c.fetch(http.MethodGet, fmt.Sprintf("%s/zones/%s/rrsets?%s", c.baseURL, url.PathEscape(zone.ID), query.Encode()), nil)
+		if err != nil {
+			return nil, false, apperror.Wrap(err)
+		}
+
+		var res struct {
+			RRSets []hcloudRRSet `json:"rrsets"`
+			Meta   struct {
+				Pagination struct {
+					NextPage int `json:"next_page"`
+				} `json:"pagination"`
+			} `json:"meta"`
+		}
+		if err := json.Unmarshal(body, &res); err != nil {
+			return nil, false, apperror.NewError("unmarshal response failed").AddError(err)
+		}
+
+		for _, set := range res.RRSets {
+			if set.Name == name && set.Type == recordType {
+				return rrsetRecord(zone, set), true, nil
+			}
+		}
+		page = res.Meta.Pagination.NextPage
+	}
+	return nil, false, nil
+}
+
+// GetRecord fetches the RRSet directly, its ID is the stable pair of name and type
+func (c *hetznerCloud) GetRecord(zone Zone, id string) (*Record, bool, error) {
+	name, recordType, ok := strings.Cut(id, "/")
+	if !ok {
+		return nil, false, nil
+	}
+	status, body, err := c.send(http.MethodGet, c.rrsetURL(zone, &Record{Name: name, Type: recordType}), nil)
+	if err != nil {
+		return nil, false, apperror.Wrap(err)
+	}
+	if status == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if err := c.check(status, body); err != nil {
+		return nil, false, apperror.Wrap(err)
+	}
+
+	var res struct {
+		RRSet hcloudRRSet `json:"rrset"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, false, apperror.NewError("unmarshal response failed").AddError(err)
+	}
+	if res.RRSet.Name == "" {
+		res.RRSet.Name, res.RRSet.Type = name, recordType
+	}
+	return rrsetRecord(zone, res.RRSet), true, nil
+}
+
+// rrsetRecord converts an RRSet into a record holding all of its values
+func rrsetRecord(zone Zone, set hcloudRRSet) *Record {
+	rec := &Record{
+		ID:       set.ID,
+		ZoneID:   zone.ID,
+		Type:     set.Type,
+		Name:     set.Name,
+		foundTTL: new(uint32),
+	}
+	if rec.ID == "" {
+		rec.ID = set.Name + "/" + set.Type
+	}
+	if set.TTL != nil {
+		rec.TTL = *set.TTL
+		*rec.foundTTL = *set.TTL
+	}
+	for _, r := range set.Records {
+		rec.Values = append(rec.Values, r.Value)
+	}
+	if len(rec.Values) > 0 {
+		rec.Value = rec.Values[0]
+	}
+	return rec
+}
+
+func (c *hetznerCloud) CreateRecord(zone Zone, record *Record) error {
+	if err := validateRecord(record); err != nil {
+		return err
+	}
+
+	set := hcloudRRSet{
+		Name:    record.Name,
+		Type:    record.Type,
+		Records: []hcloudRecord{{Value: record.Value}},
+	}
+	if record.TTL > 0 {
+		set.TTL = &record.TTL
+	}
+	return c.createRRSet(zone.ID, set)
+}
+
+// UpdateRecord replaces all values of the RRSet with the record value and adjusts the TTL if needed
+func (c *hetznerCloud) UpdateRecord(zone Zone, record *Record) error {
+	set := hcloudRRSet{
+		Name:    record.Name,
+		Type:    record.Type,
+		Records: []hcloudRecord{{Value: record.Value}},
+	}
+	if record.TTL > 0 {
+		set.TTL = &record.TTL
+	}
+	return c.setRRSet(zone.ID, set, record.foundTTL)
+}
+
+func (c *hetznerCloud) DeleteRecord(zone Zone, record *Record) error {
+	_, err := c.fetch(http.MethodDelete, c.rrsetURL(zone, record), nil)
+	if err != nil {
+		return apperror.NewError("deleting the record failed").AddError(err)
+	}
+	return nil
+}
+
+func (c *hetznerCloud) rrsetURL(zone Zone, record *Record) string {
+	return fmt.Sprintf("%s/zones/%s/rrsets/%s/%s", c.baseURL, url.PathEscape(zone.ID), url.PathEscape(record.Name), url.PathEscape(record.Type))
+}
+
+// findZone looks up a zone by its name
+func (c *hetznerCloud) findZone(name string) (*hcloudZone, bool, error) {
+	query := url.Values{}
+	query.Set("name", name)
+	body, err := c.fetch(http.MethodGet, fmt.Sprintf("%s/zones?%s", c.baseURL, query.Encode()), nil)
+	if err != nil {
+		return nil, false, apperror.Wrap(err)
+	}
+
+	var res struct {
+		Zones []hcloudZone `json:"zones"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, false, apperror.NewError("unmarshal response failed").AddError(err)
+	}
+	for _, z := range res.Zones {
+		if strings.EqualFold(z.Name, name) {
+			return &z, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// createZone creates a new primary zone
+func (c *hetznerCloud) createZone(name string) (*hcloudZone, error) {
+	data, err := json.Marshal(map[string]any{
+		"name": name,
+		"mode": "primary",
+	})
+	if err != nil {
+		return nil, apperror.NewError("marshaling the create zone failed").AddError(err)
+	}
+	body, err := c.fetch(http.MethodPost, c.baseURL+"/zones", data)
+	if err != nil {
+		return nil, apperror.NewErrorf("creating the zone %s failed", name).AddError(err)
+	}
+
+	var res struct {
+		Zone hcloudZone `json:"zone"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, apperror.NewError("unmarshal response failed").AddError(err)
+	}
+	return &res.Zone, nil
+}
+
+// rrsets lists all RRSets of a zone
+func (c *hetznerCloud) rrsets(zoneID string) ([]hcloudRRSet, error) {
+	sets := []hcloudRRSet{}
+	page := 1
+	for page > 0 {
+		body, err := c.fetch(http.MethodGet, fmt.Sprintf("%s/zones/%s/rrsets?page=%d&per_page=100", c.baseURL, url.PathEscape(zoneID), page), nil)
+		if err != nil {
+			return nil, apperror.Wrap(err)
+		}
+
+		var res struct {
+			RRSets []hcloudRRSet `json:"rrsets"`
+			Meta   struct {
+				Pagination struct {
+					NextPage int `json:"next_page"`
+				} `json:"pagination"`
+			} `json:"meta"`
+		}
+		if err := json.Unmarshal(body, &res); err != nil {
+			return nil, apperror.NewError("unmarshal response failed").AddError(err)
+		}
+		sets = append(sets, res.RRSets...)
+		page = res.Meta.Pagination.NextPage
+	}
+	return sets, nil
+}
+
+func (c *hetznerCloud) createRRSet(zoneID string, set hcloudRRSet) error {
+	data, err := json.Marshal(set)
+	if err != nil {
+		return apperror.NewError("marshaling the create record failed").AddError(err)
+	}
+
+	_, err = c.fetch(http.MethodPost, fmt.Sprintf("%s/zones/%s/rrsets", c.baseURL, url.PathEscape(zoneID)), data)
+	if err != nil {
+		return apperror.NewError("creating the record failed").AddError(err)
+	}
+	return nil
+}
+
+// setRRSet replaces all values of an existing RRSet and changes its TTL if one is given that differs from the current one
+// The TTL is changed with a second request, so it is skipped when the current TTL is known to match
+func (c *hetznerCloud) setRRSet(zoneID string, set hcloudRRSet, current *uint32) error {
+	rrsetURL := c.rrsetURL(Zone{ID: zoneID}, &Record{Name: set.Name, Type: set.Type})
+	data, err := json.Marshal(map[string]any{
+		"records": set.Records,
+	})
+	if err != nil {
+		return apperror.NewError("marshaling the update record failed").AddError(err)
+	}
+	_, err = c.fetch(http.MethodPost, rrsetURL+"/actions/set_records", data)
+	if err != nil {
+		return apperror.NewError("updating the record failed").AddError(err)
+	}
+
+	if set.TTL == nil || (current != nil && *current == *set.TTL) {
+		return nil
+	}
+
+	data, err = json.Marshal(map[string]any{
+		"ttl": *set.TTL,
+	})
+	if err != nil {
+		return apperror.NewError("marshaling the record TTL failed").AddError(err)
+	}
+	_, err = c.fetch(http.MethodPost, rrsetURL+"/actions/change_ttl", data)
+	if err != nil {
+		return apperror.NewError("updating the record TTL failed").AddError(err)
+	}
+	return nil
+}
+
+func (c *hetznerCloud) fetch(method, url string, body []byte) ([]byte, error) {
+	status, body, err := c.send(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.check(status, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// send sends a request to the API and returns the status code and body without interpreting them
+func (c *hetznerCloud) send(method, url string, body []byte) (int, []byte, error) {
+	log.Trace().Str("url", url).Str("method", method).Str("body", string(body)).Msg("HTTP request")
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, apperror.NewError("creating HTTP request failed").AddError(err)
+	}
+	req.Header.Set("User-Agent", "hdns/"+version.GitTag)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.APIToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, apperror.NewError("sending HTTP request failed").AddError(err)
+	}
+	defer apperror.Catch(resp.Body.Close, "failed to close response body")
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, apperror.NewError("reading response body failed").AddError(err)
+	}
+	log.Trace().Str("body", string(body)).Msg("HTTP response")
+	return resp.StatusCode, body, nil
+}
+
+// check turns an unsuccessful response into an error with the message of the API
+func (c *hetznerCloud) check(status int, body []byte) error {
+	if status >= 200 && status <= 299 {
+		return nil
+	}
+	var apiErr hcloudError
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Error.Message != "" {
+		return apperror.NewErrorf("HTTP request failed with status %d: %s (%s)", status, apiErr.Error.Message, apiErr.Error.Code)
+	}
+	return apperror.NewErrorf("HTTP request failed with status %d: %s", status, http.StatusText(status))
+}
@@ -0,0 +1,167 @@
+package dns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+)
+
+// testCloudDNS is an in-process Cloud DNS API serving the RRSets of one zone one per page
+type testCloudDNS struct {
+	*httptest.Server
+	mutex   sync.Mutex
+	rrsets  []hcloudRRSet
+	actions []string
+}
+
+func newTestCloudDNS(t *testing.T, rrsets ...hcloudRRSet) (*testCloudDNS, Provider, Zone) {
+	t.Helper()
+	api := &testCloudDNS{rrsets: rrsets}
+	api.Server = httptest.NewServer(http.HandlerFunc(api.serve))
+	t.Cleanup(api.Close)
+
+	p, err := NewProvider(model.Credential{Provider: "hetzner-cloud", Endpoint: api.URL, Token: "token"})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	return api, p, Zone{ID: "1", Name: "example.com"}
+}
+
+func (api *testCloudDNS) serve(w http.ResponseWriter, r *http.Request) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/zones/1/rrsets")
+	switch {
+	case r.Method == http.MethodGet && path == "":
+		// Filters are ignored so every RRSet lands on its own page
+		page := 1
+		fmt.Sscan(r.URL.Query().Get("page"), &page)
+		res := map[string]any{"rrsets": []hcloudRRSet{}}
+		if page <= len(api.rrsets) {
+			res["rrsets"] = []hcloudRRSet{api.rrsets[page-1]}
+		}
+		next := any(nil)
+		if page < len(api.rrsets) {
+			next = page + 1
+		}
+		res["meta"] = map[string]any{"pagination": map[string]any{"next_page": next}}
+		_ = json.NewEncoder(w).Encode(res)
+	case r.Method == http.MethodGet:
+		for _, set := range api.rrsets {
+			if path == "/"+set.Name+"/"+set.Type {
+				_ = json.NewEncoder(w).Encode(map[string]any{"rrset": set})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":{"code":"not_found","message":"rrset not found"}}`)
+	case r.Method == http.MethodPost && strings.Contains(path, "/actions/"):
+		var body struct {
+			TTL uint32 `json:"ttl"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		action := path[strings.LastIndex(path, "/")+1:]
+		api.actions = append(api.actions, action)
+		for i, set := range api.rrsets {
+			if action == "change_ttl" && strings.HasPrefix(path, "/"+set.Name+"/"+set.Type+"/") {
+				ttl := body.TTL
+				api.rrsets[i].TTL = &ttl
+			}
+		}
+		fmt.Fprint(w, `{"action":{"status":"running"}}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":{"code":"not_found","message":"rrset not found"}}`)
+	}
+}
+
+func (api *testCloudDNS) takeActions() []string {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	actions := api.actions
+	api.actions = nil
+	return actions
+}
+
+func TestHetznerCloudFindRecordPages(t *testing.T) {
+	ttl := uint32(300)
+	_, p, zone := newTestCloudDNS(t,
+		hcloudRRSet{ID: "www/A", Name: "www", Type: "A", Records: []hcloudRecord{{Value: "203.0.113.9"}}},
+		hcloudRRSet{ID: "home/A", Name: "home", Type: "A", TTL: &ttl, Records: []hcloudRecord{{Value: "203.0.113.1"}}},
+	)
+
+	rec, ok, err := p.FindRecord(zone, "home", "A")
+	if err != nil || !ok {
+		t.Fatalf("record on the second page not found: %v", err)
+	}
+	if rec.ID != "home/A" || rec.Value != "203.0.113.1" || rec.TTL != 300 {
+		t.Fatalf("found %+v", rec)
+	}
+	if _, ok, err := p.FindRecord(zone, "missing", "A"); err != nil || ok {
+		t.Fatalf("a missing record has to be reported as not found, got %v %v", ok, err)
+	}
+}
+
+func TestHetznerCloudChangeTTL(t *testing.T) {
+	ttl := uint32(300)
+	api, p, zone := newTestCloudDNS(t, hcloudRRSet{ID: "home/A", Name: "home", Type: "A", TTL: &ttl, Records: []hcloudRecord{{Value: "203.0.113.1"}}})
+
+	tests := []struct {
+		name    string
+		ttl     uint32
+		actions string
+	}{
+		{name: "unchanged TTL", ttl: 300, actions: "set_records"},
+		{name: "zone default TTL", ttl: 0, actions: "set_records"},
+		{name: "changed TTL", ttl: 60, actions: "set_records,change_ttl"},
+		{name: "TTL changed before", ttl: 60, actions: "set_records"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, ok, err := p.FindRecord(zone, "home", "A")
+			if err != nil || !ok {
+				t.Fatalf("record not found: %v", err)
+			}
+			rec.Value, rec.TTL = "203.0.113.2", tt.ttl
+			if err := p.UpdateRecord(zone, rec); err != nil {
+				t.Fatalf("update failed: %v", err)
+			}
+			if got := strings.Join(api.takeActions(), ","); got != tt.actions {
+				t.Fatalf("actions = %s, want %s", got, tt.actions)
+			}
+		})
+	}
+
+	// Without a lookup the current TTL is unknown and always set
+	if err := p.UpdateRecord(zone, &Record{Name: "home", Type: "A", Value: "203.0.113.3", TTL: 60}); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if got := strings.Join(api.takeActions(), ","); got != "set_records,change_ttl" {
+		t.Fatalf("actions = %s, want set_records,change_ttl", got)
+	}
+}
+
+func TestHetznerCloudGetRecord(t *testing.T) {
+	_, p, zone := newTestCloudDNS(t, hcloudRRSet{ID: "home/A", Name: "home", Type: "A", Records: []hcloudRecord{{Value: "203.0.113.1"}}})
+	getter, ok := p.(RecordGetter)
+	if !ok {
+		t.Fatal("hetzner-cloud has to address RRSets by their ID")
+	}
+
+	rec, ok, err := getter.GetRecord(zone, "home/A")
+	if err != nil || !ok || rec.ID != "home/A" || rec.Value != "203.0.113.1" {
+		t.Fatalf("got %+v %v %v", rec, ok, err)
+	}
+	for _, id := range []string{"home/AAAA", "gone/A", "invalid"} {
+		if _, ok, err := getter.GetRecord(zone, id); err != nil || ok {
+			t.Fatalf("%s has to be reported as not found, got %v %v", id, ok, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package dns
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/hdns/pkg/config"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+)
+
+func init() {
+	RegisterSource(config.SourceHCloud, func(c config.AddressSource) (Source, error) {
+		if c.Token == "" {
+			return nil, apperror.NewError("API token is required")
+		}
+		baseURL := hetznerCloudBaseURL
+		if c.URL != "" {
+			baseURL = strings.TrimSuffix(c.URL, "/")
+		}
+		resource := c.Resource
+		if resource == "" {
+			resource = config.HCloudServer
+		}
+		return &hcloudSource{
+			client:   &hetznerCloud{baseURL: baseURL, APIToken: c.Token},
+			resource: resource,
+			name:     c.Name,
+			selector: c.Selector,
+		}, nil
+	})
+}
+
+// hcloudSource reads the address of a Hetzner Cloud server, Floating IP or Primary IP so records follow it
+// when the server is rebuilt or the IP is reassigned
+type hcloudSource struct {
+	client   *hetznerCloud
+	resource string
+	name     string
+	selector string
+}
+
+type hcloudServer struct {
+	Name      string `json:"name"`
+	PublicNet struct {
+		IPv4 *struct {
+			IP string `json:"ip"`
+		} `json:"ipv4"`
+		IPv6 *struct {
+			IP string `json:"ip"`
+		} `json:"ipv6"`
+	} `json:"public_net"`
+}
+
+// hcloudIP is a Floating IP or Primary IP
+type hcloudIP struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	IP   string `json:"ip"`
+}
+
+func (s *hcloudSource) String() string {
+	if s.name != "" {
+		return "hcloud " + s.resource + " " + s.name
+	}
+	return "hcloud " + s.resource + " " + s.selector
+}
+
+func (s *hcloudSource) Address(family string) (string, error) {
+	candidates := []string{}
+	switch s.resource {
+	case config.HCloudServer:
+		var res struct {
+			Servers []hcloudServer `json:"servers"`
+		}
+		if err := s.list("/servers", &res); err != nil {
+			return "", apperror.Wrap(err)
+		}
+		for _, server := range res.Servers {
+			if family == model.FamilyIPv4 && server.PublicNet.IPv4 != nil {
+				candidates = append(candidates, server.PublicNet.IPv4.IP)
+			}
+			if family == model.FamilyIPv6 && server.PublicNet.IPv6 != nil {
+				candidates = append(candidates, server.PublicNet.IPv6.IP)
+			}
+		}
+	case config.HCloudFloatingIP, config.HCloudPrimaryIP:
+		var res struct {
+			FloatingIPs []hcloudIP `json:"floating_ips"`
+			PrimaryIPs  []hcloudIP `json:"primary_ips"`
+		}
+		if err := s.list("/"+s.resource+"s", &res); err != nil {
+			return "", apperror.Wrap(err)
+		}
+		for _, ip := range append(res.FloatingIPs, res.PrimaryIPs...) {
+			if ip.Type == family {
+				candidates = append(candidates, ip.IP)
+			}
+		}
+	default:
+		return "", apperror.NewErrorf("unknown hcloud resource %q", s.resource)
+	}
+
+	matches := []string{}
+	for _, candidate := range candidates {
+		addr := hcloudHost(candidate)
+		if ValidateAddress(addr) && Family(addr) == family {
+			matches = append(matches, addr)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", apperror.NewErrorf("no %s address found for %s", family, s)
+	case 1:
+		return matches[0], nil
+	}
+	// Picking one of several matches would publish whichever the API happens to list first
+	return "", apperror.NewErrorf("found %d %s addresses for %s (%s), narrow the name or label selector", len(matches), family, s, strings.Join(matches, ", "))
+}
+
+// list fetches the resources matching the name or label selector
+func (s *hcloudSource) list(path string, v any) error {
+	query := url.Values{}
+	if s.name != "" {
+		query.Set("name", s.name)
+	}
+	if s.selector != "" {
+		query.Set("label_selector", s.selector)
+	}
+	body, err := s.client.fetch(http.MethodGet, s.client.baseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return apperror.NewErrorf("failed to list hcloud %ss", s.resource).AddError(err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return apperror.NewError("unmarshal response failed").AddError(err)
+	}
+	return nil
+}
+
+// hcloudHost returns the address of the host, IPv6 is assigned as a /64 network whose ::1 is used by the server
+func hcloudHost(ip string) string {
+	_, network, err := net.ParseCIDR(ip)
+	if err != nil {
+		return ip
+	}
+	if network.IP.To4() != nil {
+		return network.IP.String()
+	}
+	host := network.IP.To16()
+	host[len(host)-1] |= 1
+	return host.String()
+}
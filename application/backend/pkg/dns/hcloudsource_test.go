@@ -0,0 +1,66 @@
+package dns
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Valentin-Kaiser/hdns/pkg/config"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+)
+
+func TestHCloudSource(t *testing.T) {
+	// The selector app=web matches a single server and role=gateway matches two
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		servers := []string{}
+		add := func(name, ipv4, ipv6 string) {
+			servers = append(servers, fmt.Sprintf(`{"name":%q,"public_net":{"ipv4":{"ip":%q},"ipv6":{"ip":%q}}}`, name, ipv4, ipv6))
+		}
+		switch r.URL.Query().Get("label_selector") {
+		case "app=web":
+			add("web", "203.0.113.1", "2001:db8:1::/64")
+		case "role=gateway":
+			add("gw1", "203.0.113.2", "2001:db8:2::/64")
+			add("gw2", "203.0.113.3", "2001:db8:3::/64")
+		}
+		fmt.Fprintf(w, `{"servers":[%s]}`, strings.Join(servers, ","))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		selector string
+		family   string
+		want     string
+		wantErr  string
+	}{
+		{name: "single ipv4", selector: "app=web", family: model.FamilyIPv4, want: "203.0.113.1"},
+		{name: "single ipv6", selector: "app=web", family: model.FamilyIPv6, want: "2001:db8:1::1"},
+		{name: "duplicate", selector: "role=gateway", family: model.FamilyIPv4, wantErr: "found 2 ipv4 addresses"},
+		{name: "none", selector: "role=none", family: model.FamilyIPv4, wantErr: "no ipv4 address found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewSource(config.AddressSource{Type: config.SourceHCloud, URL: server.URL, Token: "token", Selector: tt.selector})
+			if err != nil {
+				t.Fatalf("failed to create source: %v", err)
+			}
+			got, err := source.Address(tt.family)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error containing %q, got %q %v", tt.wantErr, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("address = %q, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package dns
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/go-core/database"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+const (
+	// failureThreshold is the number of consecutive failures after which a resolver is skipped
+	failureThreshold = 3
+	// reliabilityWeight is the weight of the latest outcome in the moving reliability score
+	reliabilityWeight = 0.3
+)
+
+var (
+	healthMutex  = &sync.Mutex{}
+	healthStats  = make(map[string]*model.Health)
+	healthLoaded = false
+	coolDown     = 5 * time.Minute
+	maxCoolDown  = time.Hour
+)
+
+// HealthStats returns the tracked health of all resolvers and DNS servers
+func HealthStats() []model.Health {
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+	loadHealth()
+
+	stats := make([]model.Health, 0, len(healthStats))
+	for _, h := range healthStats {
+		stats = append(stats, *h)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return healthKey(stats[i].Kind, stats[i].Family, stats[i].Name) < healthKey(stats[j].Kind, stats[j].Family, stats[j].Name)
+	})
+	return stats
+}
+
+// ResetHealth forgets all tracked health so every resolver and DNS server is tried again
+func ResetHealth() error {
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+
+	err := database.Execute(func(db *gorm.DB) error {
+		return db.Where("1 = 1").Delete(&model.Health{}).Error
+	})
+	if err != nil {
+		return apperror.NewError("failed to delete health statistics").AddError(err)
+	}
+	healthStats = make(map[string]*model.Health)
+	return nil
+}
+
+// observe records the outcome of asking a resolver or DNS server
+// Repeated failures put it into a cool-down that doubles with every further failure
+func observe(kind, family, name string, latency time.Duration, err error) {
+	h := track(kind, family, name, latency, err)
+	err = database.Execute(func(db *gorm.DB) error {
+		return db.Save(&h).Error
+	})
+	if err != nil {
+		log.Debug().Err(err).Msgf("failed to save health of %s %s", kind, name)
+		return
+	}
+
+	// A first save creates the row, later saves have to update it
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+	if tracked, ok := healthStats[healthKey(kind, family, name)]; ok && tracked.ID == 0 {
+		tracked.ID = h.ID
+	}
+}
+
+// track updates the tracked health with the outcome and returns a copy to persist without holding the health mutex
+func track(kind, family, name string, latency time.Duration, err error) model.Health {
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+	loadHealth()
+
+	key := healthKey(kind, family, name)
+	h, ok := healthStats[key]
+	if !ok {
+		h = &model.Health{Kind: kind, Family: family, Name: name, Reliability: 1}
+		healthStats[key] = h
+	}
+
+	now := time.Now()
+	outcome := 1.0
+	if err != nil {
+		outcome = 0
+		h.Failures++
+		h.ConsecutiveFailures++
+		h.LastError = err.Error()
+		h.LastFailure = &now
+		if h.ConsecutiveFailures >= failureThreshold {
+			wait := coolDown << min(h.ConsecutiveFailures-failureThreshold, 8)
+			until := now.Add(min(wait, maxCoolDown))
+			h.SkipUntil = &until
+			log.Warn().Msgf("[DNS] %s %s failed %d times in a row, skipping it until %s", kind, name, h.ConsecutiveFailures, until.Format(time.TimeOnly))
+		}
+	} else {
+		h.Successes++
+		h.ConsecutiveFailures = 0
+		h.LastSuccess = &now
+		h.SkipUntil = nil
+		h.Latency = movingLatency(h, latency)
+	}
+	h.Reliability = (1-reliabilityWeight)*h.Reliability + reliabilityWeight*outcome
+	return *h
+}
+
+// coolingDown reports until when a resolver or DNS server is skipped after repeated failures
+func coolingDown(kind, family, name string) (time.Time, bool) {
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+	loadHealth()
+
+	h, ok := healthStats[healthKey(kind, family, name)]
+	if !ok || h.SkipUntil == nil || time.Now().After(*h.SkipUntil) {
+		return time.Time{}, false
+	}
+	return *h.SkipUntil, true
+}
+
+// rank orders items by their recent reliability and leaves out those cooling down after repeated failures
+// Items cooling down are only returned when no other item is left, items with the same reliability keep their configured order
+func rank[T any](kind, family string, items []T, name func(T) string) []T {
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+	loadHealth()
+
+	now := time.Now()
+	reliability := func(item T) float64 {
+		h, ok := healthStats[healthKey(kind, family, name(item))]
+		if !ok {
+			return 1
+		}
+		return h.Reliability
+	}
+
+	ranked := slices.DeleteFunc(slices.Clone(items), func(item T) bool {
+		h, ok := healthStats[healthKey(kind, family, name(item))]
+		return ok && h.SkipUntil != nil && now.Before(*h.SkipUntil)
+	})
+	if len(ranked) == 0 {
+		ranked = slices.Clone(items)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return reliability(ranked[i]) > reliability(ranked[j])
+	})
+	return ranked
+}
+
+// loadHealth reads the persisted health once, the caller has to hold the health mutex
+func loadHealth() {
+	if healthLoaded {
+		return
+	}
+	healthLoaded = true
+
+	var stats []*model.Health
+	err := database.Execute(func(db *gorm.DB) error {
+		return db.Find(&stats).Error
+	})
+	if err != nil {
+		log.Debug().Err(err).Msg("failed to load health statistics")
+		return
+	}
+	for _, h := range stats {
+		healthStats[healthKey(h.Kind, h.Family, h.Name)] = h
+	}
+}
+
+// movingLatency averages the response time in milliseconds over the recent successes
+func movingLatency(h *model.Health, latency time.Duration) int64 {
+	if h.Successes <= 1 {
+		return latency.Milliseconds()
+	}
+	return (h.Latency*7 + latency.Milliseconds()*3) / 10
+}
+
+func healthKey(kind, family, name string) string {
+	return strings.Join([]string{kind, family, name}, "|")
+}
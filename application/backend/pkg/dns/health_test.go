@@ -0,0 +1,81 @@
+package dns
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+)
+
+func TestRank(t *testing.T) {
+	const kind = "test"
+	future, past := time.Now().Add(time.Minute), time.Now().Add(-time.Minute)
+	setHealth := func(stats map[string]*model.Health) {
+		healthMutex.Lock()
+		defer healthMutex.Unlock()
+		loadHealth()
+		for key := range healthStats {
+			if healthStats[key].Kind == kind {
+				delete(healthStats, key)
+			}
+		}
+		for name, h := range stats {
+			h.Kind, h.Family, h.Name = kind, model.FamilyIPv4, name
+			healthStats[healthKey(kind, model.FamilyIPv4, name)] = h
+		}
+	}
+	t.Cleanup(func() { setHealth(nil) })
+
+	tests := []struct {
+		name  string
+		stats map[string]*model.Health
+		want  []string
+	}{
+		{
+			name: "configured order without statistics",
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "most reliable first",
+			stats: map[string]*model.Health{
+				"a": {Reliability: 0.5},
+				"c": {Reliability: 0.9},
+			},
+			want: []string{"b", "c", "a"},
+		},
+		{
+			name: "cooling down is skipped",
+			stats: map[string]*model.Health{
+				"a": {Reliability: 0.2, SkipUntil: &future},
+				"b": {Reliability: 0.5},
+			},
+			want: []string{"c", "b"},
+		},
+		{
+			name: "expired cool-down",
+			stats: map[string]*model.Health{
+				"a": {Reliability: 0.2, SkipUntil: &past},
+			},
+			want: []string{"b", "c", "a"},
+		},
+		{
+			name: "all cooling down",
+			stats: map[string]*model.Health{
+				"a": {Reliability: 0.1, SkipUntil: &future},
+				"b": {Reliability: 0.3, SkipUntil: &future},
+				"c": {Reliability: 0.2, SkipUntil: &future},
+			},
+			want: []string{"b", "c", "a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setHealth(tt.stats)
+			got := rank(kind, model.FamilyIPv4, []string{"a", "b", "c"}, func(s string) string { return s })
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("rank = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,71 +6,44 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Valentin-Kaiser/go-core/apperror"
-	"github.com/Valentin-Kaiser/go-core/database"
 	"github.com/Valentin-Kaiser/go-core/version"
 	"github.com/Valentin-Kaiser/hdns/pkg/model"
 	"github.com/rs/zerolog/log"
-	"gorm.io/gorm"
 )
 
-const (
-	hetznerBaseURL = "https://dns.hetzner.com/api/v1"
+var (
+	// HetznerBaseURL is the default API of the hetzner provider, a credential endpoint takes precedence
+	HetznerBaseURL = "https://dns.hetzner.com/api/v1"
+	// hetznerRetries is how often a rate limited request is repeated after waiting as long as Retry-After asks
+	hetznerRetries = 3
+	// hetznerMaxWait caps the wait for a rate limit so a refresh is not blocked for long
+	hetznerMaxWait = 30 * time.Second
 )
 
-type client struct {
-	APIToken string
-}
-
-type Record struct {
-	ID     string `json:"id"`
-	ZoneID string `json:"zone_id"`
-	Type   string `json:"type"`
-	Name   string `json:"name"`
-	Value  string `json:"value"`
-	TTL    uint32 `json:"ttl"`
-	Error  string `json:"error"`
-}
-
-type Zone struct {
-	ID           string `json:"id"`
-	Name         string `json:"name"`
-	RecordsCount int    `json:"records_count"`
-}
-
-func UpdateRecord(r *model.Record, addr *model.Address) error {
-	err := updateHetzner(r, addr.IP)
-	if err != nil {
-		return apperror.Wrap(err)
-	}
-	log.Info().Msgf("[DNS] record %s.%s updated successfully", r.Name, r.Domain)
-
-	r.AddressID = &addr.ID
-	r.Address = addr
-	err = database.Execute(func(db *gorm.DB) error {
-		return db.Save(&r).Error
+func init() {
+	RegisterProvider("hetzner", func(c model.Credential) (Provider, error) {
+		baseURL := HetznerBaseURL
+		if c.Endpoint != "" {
+			baseURL = strings.TrimSuffix(c.Endpoint, "/")
+		}
+		return &hetzner{baseURL: baseURL, APIToken: c.Token.String()}, nil
 	})
-	if err != nil {
-		return apperror.NewErrorf("failed to update DNS record %s.%s in database", r.Name, r.Domain).AddError(err)
-	}
-
-	return nil
 }
 
-func FetchRecord(r *model.Record) (*Record, bool, error) {
-	c := &client{APIToken: r.Token.String()}
-	rec, found, err := c.findRecord(r)
-	if err != nil {
-		return nil, false, apperror.Wrap(err)
-	}
-	return rec, found, nil
+// hetzner talks to the Hetzner DNS Console API
+type hetzner struct {
+	baseURL  string
+	APIToken string
 }
 
-func FetchZones(token string) ([]Zone, error) {
-	c := &client{APIToken: token}
-	url := hetznerBaseURL + "/zones"
+func (c *hetzner) Zones() ([]Zone, error) {
+	url := c.baseURL + "/zones"
 	body, err := c.fetch(http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
@@ -88,57 +61,12 @@ func FetchZones(token string) ([]Zone, error) {
 	return res.Zones, nil
 }
 
-func DeleteRecord(r *model.Record) error {
-	c := &client{APIToken: r.Token.String()}
-	rec, found, err := c.findRecord(r)
-	if err != nil {
-		return apperror.Wrap(err)
-	}
-	if !found {
-		return apperror.NewError("record not found")
-	}
-	return c.deleteRecord(rec.ID)
-}
-
-func updateHetzner(r *model.Record, ip string) error {
-	c := &client{APIToken: r.Token.String()}
-	rec, found, err := c.findRecord(r)
-	if err != nil {
-		return apperror.Wrap(err)
-	}
-	if !found {
-		newRecord := &Record{
-			ZoneID: r.ZoneID,
-			Type:   "A",
-			Name:   r.Name,
-			TTL:    r.TTL,
-			Value:  ip,
-		}
-		err = c.createRecord(newRecord)
-		if err != nil {
-			return apperror.Wrap(err)
-		}
-	}
-
-	if found {
-		rec.Value = ip
-		rec.TTL = r.TTL
-		err = c.updateRecord(rec)
-		if err != nil {
-			return apperror.Wrap(err)
-		}
-	}
-
-	r.LastUpdate = time.Now()
-	return nil
-}
-
-func (c *client) updateRecord(record *Record) error {
+func (c *hetzner) UpdateRecord(_ Zone, record *Record) error {
 	data, err := json.Marshal(record)
 	if err != nil {
 		return apperror.NewError("marshaling the update record failed").AddError(err)
 	}
-	url := hetznerBaseURL + "/records/" + record.ID
+	url := c.baseURL + "/records/" + record.ID
 	body, err := c.fetch(http.MethodPut, url, data)
 	if err != nil {
 		return apperror.NewError("updating the record failed").AddError(err)
@@ -146,23 +74,34 @@ func (c *client) updateRecord(record *Record) error {
 	return c.handleAPIResponse(body, "update")
 }
 
-func (c *client) createRecord(record *Record) error {
-	if err := c.validateRecord(record); err != nil {
+func (c *hetzner) CreateRecord(_ Zone, record *Record) error {
+	if err := validateRecord(record); err != nil {
 		return err
 	}
 	data, err := json.Marshal(record)
 	if err != nil {
 		return apperror.NewError("marshaling the create record failed").AddError(err)
 	}
-	body, err := c.fetch(http.MethodPost, hetznerBaseURL+"/records", data)
+	body, err := c.fetch(http.MethodPost, c.baseURL+"/records", data)
 	if err != nil {
 		return err
 	}
-	return c.handleAPIResponse(body, "create")
+	if err := c.handleAPIResponse(body, "create"); err != nil {
+		return err
+	}
+
+	var res struct {
+		Record Record `json:"record"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return apperror.NewError("unmarshal response for create action failed").AddError(err)
+	}
+	record.ID = res.Record.ID
+	return nil
 }
 
-func (c *client) deleteRecord(recordID string) error {
-	url := hetznerBaseURL + "/records/" + recordID
+func (c *hetzner) DeleteRecord(_ Zone, record *Record) error {
+	url := c.baseURL + "/records/" + record.ID
 	body, err := c.fetch(http.MethodDelete, url, nil)
 	if err != nil {
 		return apperror.NewError("deleting the record failed").AddError(err)
@@ -170,71 +109,219 @@ func (c *client) deleteRecord(recordID string) error {
 	return c.handleAPIResponse(body, "delete")
 }
 
-func (c *client) findRecord(r *model.Record) (*Record, bool, error) {
-	url := fmt.Sprintf("%s?zone_id=%s&name=%s&type=A", hetznerBaseURL+"/records", r.ZoneID, r.Name)
-	body, err := c.fetch(http.MethodGet, url, nil)
+// FindRecord searches the zone for a record, the API does not filter by name and type so the zone is listed
+func (c *hetzner) FindRecord(zone Zone, name, recordType string) (*Record, bool, error) {
+	records, err := c.ZoneRecords(zone)
+	if err != nil {
+		return nil, false, apperror.Wrap(err)
+	}
+	return matchRecord(zone, records, name, recordType)
+}
+
+// GetRecord fetches a record by its ID
+func (c *hetzner) GetRecord(zone Zone, id string) (*Record, bool, error) {
+	status, body, err := c.request(http.MethodGet, c.baseURL+"/records/"+url.PathEscape(id), nil)
 	if err != nil {
 		return nil, false, err
 	}
+	if status == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if err := c.check(status, body); err != nil {
+		return nil, false, err
+	}
 
 	var res struct {
-		Records []Record `json:"records"`
-		Error   string   `json:"error"`
+		Record Record `json:"record"`
 	}
 	if err := json.Unmarshal(body, &res); err != nil {
 		return nil, false, apperror.NewError("unmarshal response failed").AddError(err)
 	}
-	if res.Error != "" {
-		return nil, false, apperror.NewError("record not found").AddError(apperror.NewError(res.Error))
-	}
-	if len(res.Records) == 0 {
+	if res.Record.ZoneID != zone.ID {
 		return nil, false, nil
 	}
-	return &res.Records[0], true, nil
+	return &res.Record, true, nil
 }
 
-func (c *client) fetch(method, url string, body []byte) ([]byte, error) {
+// findZone looks up a zone by its name
+func (c *hetzner) findZone(name string) (*Zone, bool, error) {
+	zones, err := c.Zones()
+	if err != nil {
+		return nil, false, apperror.Wrap(err)
+	}
+	for _, z := range zones {
+		if strings.EqualFold(z.Name, name) {
+			return &z, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// ZoneRecords lists all records of a zone
+func (c *hetzner) ZoneRecords(zone Zone) ([]Record, error) {
+	zoneID := zone.ID
+	records := []Record{}
+	for page, last := 1, 1; page <= last; page++ {
+		query := url.Values{}
+		query.Set("zone_id", zoneID)
+		query.Set("page", strconv.Itoa(page))
+		query.Set("per_page", "100")
+		body, err := c.fetch(http.MethodGet, fmt.Sprintf("%s/records?%s", c.baseURL, query.Encode()), nil)
+		if err != nil {
+			return nil, apperror.Wrap(err)
+		}
+
+		var res struct {
+			Records []Record `json:"records"`
+			Meta    struct {
+				Pagination struct {
+					LastPage int `json:"last_page"`
+				} `json:"pagination"`
+			} `json:"meta"`
+		}
+		if err := json.Unmarshal(body, &res); err != nil {
+			return nil, apperror.NewError("unmarshal response failed").AddError(err)
+		}
+		records = append(records, res.Records...)
+		last = res.Meta.Pagination.LastPage
+	}
+	return records, nil
+}
+
+// CreateRecords creates all records with a single bulk request
+func (c *hetzner) CreateRecords(_ Zone, records []*Record) error {
+	data, err := json.Marshal(map[string]any{"records": records})
+	if err != nil {
+		return apperror.NewError("marshaling the bulk create records failed").AddError(err)
+	}
+	body, err := c.fetch(http.MethodPost, c.baseURL+"/records/bulk", data)
+	if err != nil {
+		return apperror.NewError("creating the records failed").AddError(err)
+	}
+
+	var res struct {
+		Records        []Record `json:"records"`
+		InvalidRecords []Record `json:"invalid_records"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return apperror.NewError("unmarshal response for bulk create action failed").AddError(err)
+	}
+	markFailed(records, res.InvalidRecords, "record was rejected as invalid")
+	for _, created := range res.Records {
+		for _, r := range records {
+			if r.ID == "" && r.Name == created.Name && r.Type == created.Type {
+				r.ID = created.ID
+			}
+		}
+	}
+	return nil
+}
+
+// UpdateRecords updates all records with a single bulk request
+func (c *hetzner) UpdateRecords(_ Zone, records []*Record) error {
+	data, err := json.Marshal(map[string]any{"records": records})
+	if err != nil {
+		return apperror.NewError("marshaling the bulk update records failed").AddError(err)
+	}
+	body, err := c.fetch(http.MethodPut, c.baseURL+"/records/bulk", data)
+	if err != nil {
+		return apperror.NewError("updating the records failed").AddError(err)
+	}
+
+	var res struct {
+		FailedRecords []Record `json:"failed_records"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return apperror.NewError("unmarshal response for bulk update action failed").AddError(err)
+	}
+	markFailed(records, res.FailedRecords, "record update failed")
+	return nil
+}
+
+// markFailed sets the error of every record the bulk response reported as failed
+func markFailed(records []*Record, failed []Record, fallback string) {
+	for _, f := range failed {
+		for _, r := range records {
+			if (f.ID != "" && f.ID == r.ID) || (f.ID == "" && f.Name == r.Name && f.Type == r.Type) {
+				r.Error = f.Error
+				if r.Error == "" {
+					r.Error = fallback
+				}
+			}
+		}
+	}
+}
+
+func (c *hetzner) fetch(method, url string, body []byte) ([]byte, error) {
+	status, body, err := c.request(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.check(status, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// request sends a request to the API and returns the status code and body without interpreting them
+// Rate limited requests are repeated a few times
+func (c *hetzner) request(method, url string, body []byte) (int, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		status, res, wait, err := c.send(method, url, body)
+		if err != nil || status != http.StatusTooManyRequests || attempt >= hetznerRetries {
+			return status, res, err
+		}
+		log.Warn().Msgf("[DNS] Hetzner DNS API is rate limiting, retrying in %s", wait)
+		time.Sleep(wait)
+	}
+}
+
+// send sends a single request and returns how long the API asks to wait before the next one
+func (c *hetzner) send(method, url string, body []byte) (int, []byte, time.Duration, error) {
 	log.Trace().Str("url", url).Str("method", method).Str("body", string(body)).Msg("HTTP request")
 	req, err := http.NewRequest(method, url, bytes.NewReader(body))
 	if err != nil {
-		return nil, apperror.NewError("creating HTTP request failed").AddError(err)
+		return 0, nil, 0, apperror.NewError("creating HTTP request failed").AddError(err)
 	}
 	req.Header.Set("User-Agent", "hdns/"+version.GitTag)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Auth-API-Token", c.APIToken)
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, apperror.NewError("sending HTTP request failed").AddError(err)
+		return 0, nil, 0, apperror.NewError("sending HTTP request failed").AddError(err)
 	}
 	defer apperror.Catch(resp.Body.Close, "failed to close response body")
-	if resp.StatusCode != http.StatusOK {
-		return nil, apperror.NewErrorf("HTTP request failed with status %d: %s", resp.StatusCode, http.StatusText(resp.StatusCode))
-	}
 	body, err = io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, apperror.NewError("reading response body failed").AddError(err)
+		return 0, nil, 0, apperror.NewError("reading response body failed").AddError(err)
 	}
 	log.Trace().Str("body", string(body)).Msg("HTTP response")
-	return body, nil
+
+	wait := time.Second
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		wait = min(time.Duration(seconds)*time.Second, hetznerMaxWait)
+	}
+	return resp.StatusCode, body, wait, nil
 }
 
-func (c *client) validateRecord(r *Record) error {
-	switch {
-	case r.ZoneID == "":
-		return apperror.NewError("zone ID is required")
-	case r.Type == "":
-		return apperror.NewError("record type is required")
-	case r.Name == "":
-		return apperror.NewError("record name is required")
-	case r.Value == "":
-		return apperror.NewError("record value is required")
-	case !ValidateAddress(r.Value):
-		return apperror.NewError("record value is invalid")
+// check converts a response with an unexpected status code into an error
+func (c *hetzner) check(status int, body []byte) error {
+	if status == http.StatusOK {
+		return nil
 	}
-	return nil
+	var res struct {
+		Message string `json:"message"`
+		Error   struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &res) == nil && (res.Error.Message != "" || res.Message != "") {
+		return apperror.NewErrorf("HTTP request failed with status %d: %s", status, res.Error.Message+res.Message)
+	}
+	return apperror.NewErrorf("HTTP request failed with status %d: %s", status, http.StatusText(status))
 }
 
-func (c *client) handleAPIResponse(body []byte, action string) error {
+func (c *hetzner) handleAPIResponse(body []byte, action string) error {
 	var r struct {
 		Error map[string]interface{} `json:"error"`
 	}
@@ -0,0 +1,175 @@
+package dns
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Valentin-Kaiser/hdns/pkg/dns/hetznertest"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+)
+
+// newTestHetzner starts the fake API with the zone example.com and returns a client for it
+func newTestHetzner(t *testing.T) (*hetznertest.Server, Provider, Zone) {
+	t.Helper()
+	server := hetznertest.NewServer("token")
+	t.Cleanup(server.Close)
+	z := server.AddZone("example.com")
+
+	p, err := NewProvider(model.Credential{Provider: "hetzner", Endpoint: server.URL, Token: "token"})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	return server, p, Zone{ID: z.ID, Name: z.Name}
+}
+
+func TestHetznerRoundTrip(t *testing.T) {
+	_, p, zone := newTestHetzner(t)
+
+	record := &Record{ZoneID: zone.ID, Type: "A", Name: "home", Value: "203.0.113.1", TTL: 60}
+	if err := p.CreateRecord(zone, record); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if record.ID == "" {
+		t.Fatal("created record has no ID")
+	}
+
+	found, ok, err := p.FindRecord(zone, "home", "A")
+	if err != nil || !ok {
+		t.Fatalf("created record not found: %v", err)
+	}
+	if found.ID != record.ID || found.Value != "203.0.113.1" {
+		t.Fatalf("found %+v, want ID %s and value 203.0.113.1", found, record.ID)
+	}
+
+	record.Value = "203.0.113.2"
+	if err := p.UpdateRecord(zone, record); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	got, ok, err := p.(RecordGetter).GetRecord(zone, record.ID)
+	if err != nil || !ok {
+		t.Fatalf("updated record not found: %v", err)
+	}
+	if got.Value != "203.0.113.2" {
+		t.Fatalf("value is %s after the update, want 203.0.113.2", got.Value)
+	}
+
+	_, ok, err = p.(RecordGetter).GetRecord(zone, "missing")
+	if err != nil || ok {
+		t.Fatalf("a missing record has to be reported as not found, got %v %v", ok, err)
+	}
+	_, ok, err = p.FindRecord(zone, "other", "A")
+	if err != nil || ok {
+		t.Fatalf("an unknown name has to be reported as not found, got %v %v", ok, err)
+	}
+}
+
+func TestHetznerDuplicateRecords(t *testing.T) {
+	server, p, zone := newTestHetzner(t)
+	server.AddRecord(hetznertest.Record{ZoneID: zone.ID, Type: "A", Name: "home", Value: "203.0.113.1"})
+	server.AddRecord(hetznertest.Record{ZoneID: zone.ID, Type: "A", Name: "home", Value: "203.0.113.2"})
+
+	_, _, err := p.FindRecord(zone, "home", "A")
+	if err == nil || !strings.Contains(err.Error(), "found 2 A records") {
+		t.Fatalf("expected a duplicate error, got %v", err)
+	}
+}
+
+func TestHetznerUnauthorized(t *testing.T) {
+	server, _, _ := newTestHetzner(t)
+	p, err := NewProvider(model.Credential{Provider: "hetzner", Endpoint: server.URL, Token: "wrong"})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	_, err = p.Zones()
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected a 401 error, got %v", err)
+	}
+}
+
+func TestHetznerRateLimit(t *testing.T) {
+	server, p, zone := newTestHetzner(t)
+	defer func(wait time.Duration) { hetznerMaxWait = wait }(hetznerMaxWait)
+	hetznerMaxWait = 10 * time.Millisecond
+
+	server.FailNext(http.StatusTooManyRequests, http.StatusTooManyRequests)
+	record := &Record{ZoneID: zone.ID, Type: "A", Name: "home", Value: "203.0.113.1"}
+	if err := p.CreateRecord(zone, record); err != nil {
+		t.Fatalf("rate limited create was not retried: %v", err)
+	}
+	if n := server.Requests(); n != 3 {
+		t.Fatalf("served %d requests, want 3", n)
+	}
+
+	server.FailNext(http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests)
+	if err := p.UpdateRecord(zone, record); err == nil {
+		t.Fatal("expected an error once the retries are used up")
+	}
+	if n := server.Requests(); n != 3+1+hetznerRetries {
+		t.Fatalf("served %d requests, want %d", n, 3+1+hetznerRetries)
+	}
+}
+
+func TestHetznerBulk(t *testing.T) {
+	server, p, zone := newTestHetzner(t)
+	bulk := p.(BulkProvider)
+
+	records := []*Record{
+		{ZoneID: zone.ID, Type: "A", Name: "one", Value: "203.0.113.1"},
+		{ZoneID: zone.ID, Type: "A", Name: "two", Value: "203.0.113.2"},
+		{ZoneID: "unknown", Type: "A", Name: "three", Value: "203.0.113.3"},
+	}
+	if err := bulk.CreateRecords(zone, records); err != nil {
+		t.Fatalf("bulk create failed: %v", err)
+	}
+	if records[0].ID == "" || records[1].ID == "" || records[0].Error != "" || records[1].Error != "" {
+		t.Fatalf("valid records were not created: %+v %+v", records[0], records[1])
+	}
+	if records[2].ID != "" || records[2].Error == "" {
+		t.Fatalf("invalid record was not marked as failed: %+v", records[2])
+	}
+	if n := len(server.Records(zone.ID)); n != 2 {
+		t.Fatalf("zone holds %d records, want 2", n)
+	}
+
+	updates := []*Record{
+		{ID: records[0].ID, ZoneID: zone.ID, Type: "A", Name: "one", Value: "198.51.100.1"},
+		{ID: "missing", ZoneID: zone.ID, Type: "A", Name: "gone", Value: "198.51.100.2"},
+	}
+	if err := bulk.UpdateRecords(zone, updates); err != nil {
+		t.Fatalf("bulk update failed: %v", err)
+	}
+	if updates[0].Error != "" || updates[1].Error == "" {
+		t.Fatalf("only the missing record should fail: %+v %+v", updates[0], updates[1])
+	}
+	listed, err := bulk.ZoneRecords(zone)
+	if err != nil {
+		t.Fatalf("listing the zone failed: %v", err)
+	}
+	for _, r := range listed {
+		if r.Name == "one" && r.Value != "198.51.100.1" {
+			t.Fatalf("bulk update was not applied, value is %s", r.Value)
+		}
+	}
+}
+
+func TestPublishBulkTTL(t *testing.T) {
+	server, p, zone := newTestHetzner(t)
+	server.AddRecord(hetznertest.Record{ZoneID: zone.ID, Type: "A", Name: "home", Value: "203.0.113.1", TTL: 300})
+	record := &model.Record{Credential: model.Credential{Provider: "hetzner"}, Name: "home", TTL: 60}
+
+	for i, want := range []bool{true, false} {
+		d := &destination{record: record, recordType: model.RecordTypeA, value: "203.0.113.1"}
+		publishBulk(p.(BulkProvider), zone, []*destination{d})
+		if d.err != nil || d.changed != want {
+			t.Fatalf("run %d: changed = %v, %v, want %v", i+1, d.changed, d.err, want)
+		}
+	}
+	for _, r := range server.Records(zone.ID) {
+		if r.Name == "home" && r.TTL != 60 {
+			t.Fatalf("TTL is %d after the bulk update, want 60", r.TTL)
+		}
+	}
+}
@@ -0,0 +1,460 @@
+// Package hetznertest provides an in-memory fake of the Hetzner DNS Console API
+// It serves the zones and records endpoints for integration tests and the demo mode
+package hetznertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Zone is a zone as stored by the fake API
+type Zone struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	TTL          uint32 `json:"ttl"`
+	RecordsCount int    `json:"records_count"`
+}
+
+// Record is a record as stored by the fake API
+type Record struct {
+	ID     string `json:"id"`
+	ZoneID string `json:"zone_id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	TTL    uint32 `json:"ttl,omitempty"`
+}
+
+// Server is an in-memory fake of the Hetzner DNS Console API
+type Server struct {
+	// URL is the base URL of the fake API, use it as endpoint of a hetzner credential
+	URL string
+
+	server   *httptest.Server
+	mutex    sync.Mutex
+	tokens   map[string]bool
+	zones    map[string]*Zone
+	records  map[string]*Record
+	failures []int
+	requests int
+	nextID   int
+}
+
+// NewServer starts a fake API that accepts the given API tokens
+func NewServer(tokens ...string) *Server {
+	s := &Server{
+		tokens:  make(map[string]bool),
+		zones:   make(map[string]*Zone),
+		records: make(map[string]*Record),
+	}
+	for _, t := range tokens {
+		s.tokens[t] = true
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /zones", s.listZones)
+	mux.HandleFunc("POST /zones", s.createZone)
+	mux.HandleFunc("GET /zones/{id}", s.getZone)
+	mux.HandleFunc("DELETE /zones/{id}", s.deleteZone)
+	mux.HandleFunc("GET /records", s.listRecords)
+	mux.HandleFunc("POST /records", s.createRecord)
+	mux.HandleFunc("POST /records/bulk", s.createRecords)
+	mux.HandleFunc("PUT /records/bulk", s.updateRecords)
+	mux.HandleFunc("GET /records/{id}", s.getRecord)
+	mux.HandleFunc("PUT /records/{id}", s.updateRecord)
+	mux.HandleFunc("DELETE /records/{id}", s.deleteRecord)
+
+	s.server = httptest.NewServer(s.authenticate(mux))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts the fake API down
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// AddZone creates a zone and returns it
+func (s *Server) AddZone(name string) Zone {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	z := &Zone{ID: s.id(), Name: name, TTL: 86400}
+	s.zones[z.ID] = z
+	return *z
+}
+
+// AddRecord stores a record as is, an empty ID is generated
+func (s *Server) AddRecord(r Record) Record {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if r.ID == "" {
+		r.ID = s.id()
+	}
+	s.records[r.ID] = &r
+	return r
+}
+
+// Records returns all records of a zone ordered by name and type
+func (s *Server) Records(zoneID string) []Record {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.zoneRecords(zoneID)
+}
+
+// FailNext makes the next requests fail with the given HTTP status codes, e.g. 422 or 429
+func (s *Server) FailNext(status ...int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.failures = append(s.failures, status...)
+}
+
+// Requests returns the number of authenticated requests served so far
+func (s *Server) Requests() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.requests
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		if !s.tokens[r.Header.Get("Auth-API-Token")] {
+			s.mutex.Unlock()
+			writeJSON(w, http.StatusUnauthorized, map[string]any{"message": "Invalid authentication credentials"})
+			return
+		}
+
+		s.requests++
+		if len(s.failures) > 0 {
+			status := s.failures[0]
+			s.failures = s.failures[1:]
+			s.mutex.Unlock()
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "1")
+			}
+			writeError(w, status, http.StatusText(status))
+			return
+		}
+		s.mutex.Unlock()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) listZones(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	name := r.URL.Query().Get("name")
+	zones := []Zone{}
+	for _, z := range s.zones {
+		if name != "" && z.Name != name {
+			continue
+		}
+		zones = append(zones, s.withCount(z))
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].Name < zones[j].Name })
+	writeJSON(w, http.StatusOK, map[string]any{"zones": zones, "meta": pagination(1, len(zones), 1, len(zones))})
+}
+
+func (s *Server) getZone(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	z, ok := s.zones[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "zone not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"zone": s.withCount(z)})
+}
+
+func (s *Server) createZone(w http.ResponseWriter, r *http.Request) {
+	var z Zone
+	if err := json.NewDecoder(r.Body).Decode(&z); err != nil || z.Name == "" {
+		writeError(w, http.StatusUnprocessableEntity, "invalid zone")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, existing := range s.zones {
+		if existing.Name == z.Name {
+			writeError(w, http.StatusUnprocessableEntity, "zone already exists")
+			return
+		}
+	}
+	z.ID = s.id()
+	if z.TTL == 0 {
+		z.TTL = 86400
+	}
+	s.zones[z.ID] = &z
+	writeJSON(w, http.StatusOK, map[string]any{"zone": z})
+}
+
+func (s *Server) deleteZone(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := r.PathValue("id")
+	if _, ok := s.zones[id]; !ok {
+		writeError(w, http.StatusNotFound, "zone not found")
+		return
+	}
+	delete(s.zones, id)
+	for rid, rec := range s.records {
+		if rec.ZoneID == id {
+			delete(s.records, rid)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) listRecords(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	query := r.URL.Query()
+	zoneID := query.Get("zone_id")
+	if zoneID != "" {
+		if _, ok := s.zones[zoneID]; !ok {
+			writeError(w, http.StatusNotFound, "zone not found")
+			return
+		}
+	}
+
+	records := []Record{}
+	for _, rec := range s.allRecords() {
+		if zoneID != "" && rec.ZoneID != zoneID {
+			continue
+		}
+		if name := query.Get("name"); name != "" && rec.Name != name {
+			continue
+		}
+		if typ := query.Get("type"); typ != "" && rec.Type != typ {
+			continue
+		}
+		records = append(records, rec)
+	}
+
+	page, perPage := 1, 100
+	if p, err := strconv.Atoi(query.Get("page")); err == nil && p > 0 {
+		page = p
+	}
+	if p, err := strconv.Atoi(query.Get("per_page")); err == nil && p > 0 {
+		perPage = p
+	}
+	last := (len(records) + perPage - 1) / perPage
+	if last == 0 {
+		last = 1
+	}
+	start := min((page-1)*perPage, len(records))
+	end := min(start+perPage, len(records))
+	writeJSON(w, http.StatusOK, map[string]any{"records": records[start:end], "meta": pagination(page, perPage, last, len(records))})
+}
+
+func (s *Server) getRecord(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rec, ok := s.records[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "record not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"record": rec})
+}
+
+func (s *Server) createRecord(w http.ResponseWriter, r *http.Request) {
+	var rec Record
+	if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "invalid record")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if msg := s.validate(&rec); msg != "" {
+		writeError(w, http.StatusUnprocessableEntity, msg)
+		return
+	}
+	rec.ID = s.id()
+	s.records[rec.ID] = &rec
+	writeJSON(w, http.StatusOK, map[string]any{"record": rec})
+}
+
+func (s *Server) updateRecord(w http.ResponseWriter, r *http.Request) {
+	var rec Record
+	if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "invalid record")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	id := r.PathValue("id")
+	if _, ok := s.records[id]; !ok {
+		writeError(w, http.StatusNotFound, "record not found")
+		return
+	}
+	if msg := s.validate(&rec); msg != "" {
+		writeError(w, http.StatusUnprocessableEntity, msg)
+		return
+	}
+	rec.ID = id
+	s.records[id] = &rec
+	writeJSON(w, http.StatusOK, map[string]any{"record": rec})
+}
+
+func (s *Server) deleteRecord(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := r.PathValue("id")
+	if _, ok := s.records[id]; !ok {
+		writeError(w, http.StatusNotFound, "record not found")
+		return
+	}
+	delete(s.records, id)
+	writeJSON(w, http.StatusOK, map[string]any{})
+}
+
+func (s *Server) createRecords(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Records []Record `json:"records"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "invalid records")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	created, valid, invalid := []Record{}, []Record{}, []Record{}
+	for _, rec := range req.Records {
+		if s.validate(&rec) != "" {
+			invalid = append(invalid, rec)
+			continue
+		}
+		valid = append(valid, rec)
+		rec.ID = s.id()
+		s.records[rec.ID] = &rec
+		created = append(created, rec)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"records": created, "valid_records": valid, "invalid_records": invalid})
+}
+
+func (s *Server) updateRecords(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Records []Record `json:"records"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "invalid records")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	updated, failed := []Record{}, []Record{}
+	for _, rec := range req.Records {
+		if _, ok := s.records[rec.ID]; !ok || s.validate(&rec) != "" {
+			failed = append(failed, rec)
+			continue
+		}
+		s.records[rec.ID] = &rec
+		updated = append(updated, rec)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"records": updated, "failed_records": failed})
+}
+
+// validate checks a record the way the real API does and returns the error message
+func (s *Server) validate(rec *Record) string {
+	switch {
+	case rec.ZoneID == "":
+		return "zone_id is required"
+	case rec.Type == "":
+		return "type is required"
+	case rec.Name == "":
+		return "name is required"
+	case rec.Value == "":
+		return "value is required"
+	}
+	if _, ok := s.zones[rec.ZoneID]; !ok {
+		return "zone not found"
+	}
+	return ""
+}
+
+func (s *Server) zoneRecords(zoneID string) []Record {
+	records := []Record{}
+	for _, rec := range s.allRecords() {
+		if rec.ZoneID == zoneID {
+			records = append(records, rec)
+		}
+	}
+	return records
+}
+
+func (s *Server) allRecords() []Record {
+	records := make([]Record, 0, len(s.records))
+	for _, rec := range s.records {
+		records = append(records, *rec)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Name != records[j].Name {
+			return records[i].Name < records[j].Name
+		}
+		if records[i].Type != records[j].Type {
+			return records[i].Type < records[j].Type
+		}
+		return records[i].ID < records[j].ID
+	})
+	return records
+}
+
+func (s *Server) withCount(z *Zone) Zone {
+	zone := *z
+	zone.RecordsCount = len(s.zoneRecords(z.ID))
+	return zone
+}
+
+func (s *Server) id() string {
+	s.nextID++
+	return fmt.Sprintf("%032x", s.nextID)
+}
+
+func pagination(page, perPage, last, total int) map[string]any {
+	return map[string]any{
+		"pagination": map[string]any{
+			"page":          page,
+			"per_page":      perPage,
+			"last_page":     last,
+			"total_entries": total,
+		},
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{
+			"message": message,
+			"code":    status,
+		},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
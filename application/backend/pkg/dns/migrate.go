@@ -0,0 +1,350 @@
+package dns
+
+import (
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/go-core/database"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MigrationCreate = "create"
+	MigrationUpdate = "update"
+	MigrationKeep   = "keep"
+)
+
+// Migration copies a zone from the legacy Hetzner DNS Console to the Hetzner Cloud DNS API
+type Migration struct {
+	Zone   string           `json:"zone"`
+	Source model.Credential `json:"source"`
+	Target model.Credential `json:"target"`
+	DryRun bool             `json:"dry_run"`
+}
+
+// MigrationResult describes what a migration changed, or would change on a dry run
+type MigrationResult struct {
+	Zone         string            `json:"zone"`
+	SourceZoneID string            `json:"source_zone_id"`
+	TargetZoneID string            `json:"target_zone_id"`
+	Nameservers  []string          `json:"nameservers"`
+	DryRun       bool              `json:"dry_run"`
+	Changes      []MigrationChange `json:"changes"`
+	Records      []uint64          `json:"records"`
+	Targets      []uint64          `json:"targets"`
+	Checks       []MigrationCheck  `json:"checks"`
+}
+
+// MigrationChange is the diff of a single RRSet between the legacy and the new zone
+type MigrationChange struct {
+	Action  string   `json:"action"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     uint32   `json:"ttl"`
+	Values  []string `json:"values"`
+	Current []string `json:"current"`
+}
+
+// MigrationCheck is the verification of a migrated address record against the new nameservers
+type MigrationCheck struct {
+	Domain      string       `json:"domain"`
+	Type        string       `json:"type"`
+	Expected    []string     `json:"expected"`
+	Resolutions []Resolution `json:"resolutions"`
+	Verified    bool         `json:"verified"`
+}
+
+// Migrate copies all records of the zone into the Cloud DNS API and re-points the hdns records at the new zone
+// On a dry run only the diff and the affected records are reported
+func Migrate(m Migration) (*MigrationResult, error) {
+	m.Zone = strings.TrimSuffix(strings.TrimSpace(m.Zone), ".")
+	if m.Zone == "" {
+		return nil, apperror.NewError("zone is required")
+	}
+	if m.Source.Provider == "" {
+		m.Source.Provider = "hetzner"
+	}
+	if m.Target.Provider == "" {
+		m.Target.Provider = "hetzner-cloud"
+	}
+
+	sp, err := NewProvider(m.Source)
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
+	source, ok := sp.(*hetzner)
+	if !ok {
+		return nil, apperror.NewErrorf("migration source must be a hetzner provider, got %s", m.Source.Provider)
+	}
+	tp, err := NewProvider(m.Target)
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
+	target, ok := tp.(*hetznerCloud)
+	if !ok {
+		return nil, apperror.NewErrorf("migration target must be a hetzner-cloud provider, got %s", m.Target.Provider)
+	}
+
+	zone, found, err := source.findZone(m.Zone)
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
+	if !found {
+		return nil, apperror.NewErrorf("zone %s not found in the Hetzner DNS Console", m.Zone)
+	}
+
+	result := &MigrationResult{
+		Zone:         m.Zone,
+		SourceZoneID: zone.ID,
+		DryRun:       m.DryRun,
+		Changes:      []MigrationChange{},
+		Records:      []uint64{},
+		Targets:      []uint64{},
+		Checks:       []MigrationCheck{},
+	}
+
+	wanted, err := legacyRRSets(source, zone.ID)
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
+
+	existing := []hcloudRRSet{}
+	newZone, found, err := target.findZone(m.Zone)
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
+	switch {
+	case found:
+		result.TargetZoneID = zoneID(newZone)
+		result.Nameservers = newZone.AuthoritativeNameservers.Assigned
+		existing, err = target.rrsets(result.TargetZoneID)
+		if err != nil {
+			return nil, apperror.Wrap(err)
+		}
+	case !m.DryRun:
+		newZone, err = target.createZone(m.Zone)
+		if err != nil {
+			return nil, apperror.Wrap(err)
+		}
+		result.TargetZoneID = zoneID(newZone)
+		result.Nameservers = newZone.AuthoritativeNameservers.Assigned
+		log.Info().Msgf("[Migration] created zone %s in Hetzner Cloud DNS", m.Zone)
+	}
+
+	for _, set := range wanted {
+		change := diffRRSet(set, existing)
+		result.Changes = append(result.Changes, change)
+		if m.DryRun || change.Action == MigrationKeep {
+			continue
+		}
+
+		switch change.Action {
+		case MigrationCreate:
+			err = target.createRRSet(result.TargetZoneID, set)
+		case MigrationUpdate:
+			err = target.setRRSet(result.TargetZoneID, set, existingTTL(set, existing))
+		}
+		if err != nil {
+			return result, apperror.NewErrorf("failed to %s %s %s", change.Action, set.Name, set.Type).AddError(err)
+		}
+		log.Info().Msgf("[Migration] %s %s %s in zone %s", change.Action, set.Name, set.Type, m.Zone)
+	}
+
+	err = repoint(m, zone.ID, result)
+	if err != nil {
+		return result, apperror.Wrap(err)
+	}
+
+	if !m.DryRun {
+		result.Checks = verify(m.Zone, result.Nameservers, wanted)
+	}
+	return result, nil
+}
+
+// legacyRRSets groups the records of a legacy zone into RRSets
+// SOA and apex NS records are skipped since the Cloud DNS API manages them itself
+func legacyRRSets(source *hetzner, zoneID string) ([]hcloudRRSet, error) {
+	records, err := source.ZoneRecords(Zone{ID: zoneID})
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
+
+	sets := []hcloudRRSet{}
+	index := make(map[string]int)
+	for _, r := range records {
+		if r.Type == "SOA" || (r.Type == "NS" && r.Name == "@") {
+			continue
+		}
+
+		key := r.Name + "/" + r.Type
+		i, ok := index[key]
+		if !ok {
+			set := hcloudRRSet{Name: r.Name, Type: r.Type}
+			if r.TTL > 0 {
+				ttl := r.TTL
+				set.TTL = &ttl
+			}
+			sets = append(sets, set)
+			i = len(sets) - 1
+			index[key] = i
+		}
+		sets[i].Records = append(sets[i].Records, hcloudRecord{Value: r.Value})
+	}
+	return sets, nil
+}
+
+// existingTTL returns the TTL of the RRSet with the same name and type in the new zone, 0 for the zone default
+func existingTTL(set hcloudRRSet, existing []hcloudRRSet) *uint32 {
+	for _, e := range existing {
+		if e.Name != set.Name || e.Type != set.Type {
+			continue
+		}
+		ttl := uint32(0)
+		if e.TTL != nil {
+			ttl = *e.TTL
+		}
+		return &ttl
+	}
+	return nil
+}
+
+// diffRRSet compares a wanted RRSet with the RRSets already present in the new zone
+func diffRRSet(set hcloudRRSet, existing []hcloudRRSet) MigrationChange {
+	change := MigrationChange{
+		Action:  MigrationCreate,
+		Name:    set.Name,
+		Type:    set.Type,
+		Values:  rrsetValues(set),
+		Current: []string{},
+	}
+	if set.TTL != nil {
+		change.TTL = *set.TTL
+	}
+
+	for _, e := range existing {
+		if e.Name != set.Name || e.Type != set.Type {
+			continue
+		}
+		change.Current = rrsetValues(e)
+		change.Action = MigrationUpdate
+		sameTTL := set.TTL == nil || (e.TTL != nil && *e.TTL == *set.TTL)
+		if sameTTL && slices.Equal(change.Values, change.Current) {
+			change.Action = MigrationKeep
+		}
+		break
+	}
+	return change
+}
+
+// repoint moves all records and mirror targets of the legacy zone to the new zone and credential
+// The provider record IDs of the legacy zone are cleared, the next refresh looks the records up by name
+func repoint(m Migration, legacyZoneID string, result *MigrationResult) error {
+	return database.Execute(func(db *gorm.DB) error {
+		var records []model.Record
+		err := db.Where("provider = ? AND zone_id = ?", m.Source.Provider, legacyZoneID).Find(&records).Error
+		if err != nil {
+			return apperror.NewError("failed to fetch records of the migrated zone").AddError(err)
+		}
+		var targets []model.Target
+		err = db.Where("provider = ? AND zone_id = ?", m.Source.Provider, legacyZoneID).Find(&targets).Error
+		if err != nil {
+			return apperror.NewError("failed to fetch mirror targets of the migrated zone").AddError(err)
+		}
+
+		for _, r := range records {
+			result.Records = append(result.Records, r.ID)
+		}
+		for _, t := range targets {
+			result.Targets = append(result.Targets, t.ID)
+		}
+		if m.DryRun {
+			return nil
+		}
+
+		return db.Transaction(func(tx *gorm.DB) error {
+			for i := range records {
+				records[i].Credential = m.Target
+				records[i].ZoneID = result.TargetZoneID
+				records[i].ProviderRecordID, records[i].ProviderRecordIDV6 = "", ""
+				err := tx.Omit(clause.Associations).Save(&records[i]).Error
+				if err != nil {
+					return apperror.NewErrorf("failed to re-point record %s.%s", records[i].Name, records[i].Domain).AddError(err)
+				}
+			}
+			for i := range targets {
+				targets[i].Credential = m.Target
+				targets[i].ZoneID = result.TargetZoneID
+				targets[i].ProviderRecordID, targets[i].ProviderRecordIDV6 = "", ""
+				err := tx.Omit(clause.Associations).Save(&targets[i]).Error
+				if err != nil {
+					return apperror.NewErrorf("failed to re-point mirror target %d", targets[i].ID).AddError(err)
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// verify resolves every migrated address record against the nameservers of the new zone
+func verify(zone string, nameservers []string, sets []hcloudRRSet) []MigrationCheck {
+	servers := make([]string, 0, len(nameservers))
+	for _, ns := range nameservers {
+		servers = append(servers, net.JoinHostPort(strings.TrimSuffix(ns, "."), "53"))
+	}
+	resolver := NewDNSResolverFor(servers)
+
+	checks := []MigrationCheck{}
+	for _, set := range sets {
+		if set.Type != "A" && set.Type != "AAAA" {
+			continue
+		}
+
+		check := MigrationCheck{
+			Domain:   resolver.BuildDomain(&model.Record{Name: set.Name, Domain: zone}),
+			Type:     set.Type,
+			Expected: []string{},
+		}
+		for _, v := range rrsetValues(set) {
+			if ValidateAddress(v) {
+				check.Expected = append(check.Expected, v)
+			}
+		}
+
+		resolutions, err := resolver.Resolve(check.Domain)
+		if err != nil {
+			log.Warn().Err(err).Msgf("[Migration] failed to verify %s", check.Domain)
+			checks = append(checks, check)
+			continue
+		}
+		check.Resolutions = resolutions
+		check.Verified = len(resolutions) > 0
+		for _, res := range resolutions {
+			for _, expected := range check.Expected {
+				if res.Error != "" || !slices.Contains(res.Addresses, expected) {
+					check.Verified = false
+				}
+			}
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+func rrsetValues(set hcloudRRSet) []string {
+	values := make([]string, 0, len(set.Records))
+	for _, r := range set.Records {
+		values = append(values, r.Value)
+	}
+	slices.Sort(values)
+	return values
+}
+
+func zoneID(z *hcloudZone) string {
+	return strconv.FormatInt(z.ID, 10)
+}
@@ -0,0 +1,163 @@
+package dns
+
+import (
+	"net"
+	"sync"
+
+	"github.com/Valentin-Kaiser/go-core/database"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// cgnatRange is the shared address space carriers use behind their NAT (RFC 6598)
+var cgnatRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+var (
+	natMutex = &sync.Mutex{}
+	// natResults keeps the last status per uplink and family, the external services are only asked again when the WAN or public address changes
+	natResults = make(map[string]natResult)
+)
+
+type natResult struct {
+	wan    string
+	public string
+	nat    string
+}
+
+// WANSource is implemented by sources that read the address of the WAN connection from the router or a local interface
+type WANSource interface {
+	Source
+	// WAN returns the address of the WAN connection even if it is not public
+	WAN(family string) (string, error)
+}
+
+// updateNAT records on the address whether the host holds it or sits behind a carrier-grade or double NAT
+// Only IPv4 is checked, IPv6 hosts are addressed directly and routers rarely report a comparable WAN address
+func updateNAT(link *uplink, addr *model.Address) {
+	if addr.Family != model.FamilyIPv4 {
+		return
+	}
+	nat, wan := detectNAT(link, addr.Family, addr.IP)
+	switch nat {
+	case model.NATCGNAT:
+		log.Warn().Msgf("[DNS] the WAN address %s belongs to a carrier-grade NAT, the public address %s is not reachable from the internet", wan, addr.IP)
+	case model.NATDouble:
+		log.Warn().Msgf("[DNS] the WAN address %s differs from the public address %s, a second NAT makes it unreachable from the internet", wan, addr.IP)
+	}
+	addr.NAT, addr.WAN = nat, wan
+	err := database.Execute(func(db *gorm.DB) error {
+		return db.Model(addr).Updates(map[string]any{"nat": nat, "wan": wan}).Error
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to save the NAT status of the current address")
+	}
+}
+
+// detectNAT compares the WAN address the router or interface of the uplink reports with the public address external services see
+// The status stays empty when no router or interface source is configured or none of them answered
+// The last status is reused while neither the WAN address nor the current public address changed
+func detectNAT(link *uplink, family, current string) (string, string) {
+	wans, externals := natSources(link)
+	wan := wanAddress(wans, family)
+	if wan == "" {
+		return "", ""
+	}
+
+	key := link.name + "/" + family
+	natMutex.Lock()
+	last, ok := natResults[key]
+	natMutex.Unlock()
+	if ok && last.wan == wan && last.public == current {
+		return last.nat, wan
+	}
+
+	nat, known := compareNAT(wan, externals, family)
+	if known {
+		natMutex.Lock()
+		natResults[key] = natResult{wan: wan, public: current, nat: nat}
+		natMutex.Unlock()
+	}
+	return nat, wan
+}
+
+// behindCGNAT returns the WAN address of the uplink if it belongs to a carrier-grade NAT, together with the address external services see
+// Router and interface sources only know the shared address, which is never accepted as public address
+func behindCGNAT(link *uplink, family string) (string, string) {
+	if family != model.FamilyIPv4 {
+		return "", ""
+	}
+	wans, externals := natSources(link)
+	wan := wanAddress(wans, family)
+	if wan == "" || !cgnatRange.Contains(net.ParseIP(wan)) {
+		return "", ""
+	}
+	return externalAddress(externals, family), wan
+}
+
+// natSources splits the sources of the uplink into those reading the WAN address and those seeing the public address
+// The HTTP resolvers stand in for the external sources when only router or interface sources are configured
+func natSources(link *uplink) ([]WANSource, []Source) {
+	wans := []WANSource{}
+	externals := []Source{}
+	for _, c := range link.sources {
+		source, err := link.newSource(c)
+		if err != nil {
+			continue
+		}
+		if wan, ok := source.(WANSource); ok {
+			wans = append(wans, wan)
+			continue
+		}
+		externals = append(externals, source)
+	}
+	if len(externals) == 0 {
+		externals = append(externals, &httpSource{link: link})
+	}
+	return wans, externals
+}
+
+// wanAddress returns the WAN address of the first source that reports one
+func wanAddress(wans []WANSource, family string) string {
+	for _, source := range wans {
+		addr, err := source.WAN(family)
+		if err != nil {
+			log.Debug().Err(err).Msgf("[DNS] %s did not report a WAN address", source)
+			continue
+		}
+		return addr
+	}
+	return ""
+}
+
+// externalAddress returns the public address of the first external source that answers
+func externalAddress(externals []Source, family string) string {
+	for _, source := range externals {
+		addr, err := source.Address(family)
+		if err != nil {
+			continue
+		}
+		return addr
+	}
+	return ""
+}
+
+// compareNAT compares the WAN address with the public address the first answering external source sees
+// It reports false when the status could not be determined for sure, so the check is repeated on the next refresh
+func compareNAT(wan string, externals []Source, family string) (string, bool) {
+	if cgnatRange.Contains(net.ParseIP(wan)) {
+		return model.NATCGNAT, true
+	}
+
+	public := externalAddress(externals, family)
+	switch {
+	case public == "" && !ValidateAddress(wan):
+		// A private WAN address means another router sits in front even without knowing the public address
+		return model.NATDouble, false
+	case public == "":
+		return "", false
+	case public != wan:
+		return model.NATDouble, true
+	}
+	return model.NATNone, true
+}
@@ -0,0 +1,132 @@
+package dns
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/hdns/pkg/config"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+)
+
+// testWANSource reports the address in wan as WAN address, like a router behind the test public source
+type testWANSource struct{ wan *atomic.Value }
+
+func (s testWANSource) String() string { return "test wan" }
+
+func (s testWANSource) Address(family string) (string, error) {
+	addr, _ := s.WAN(family)
+	if !ValidateAddress(addr) {
+		return "", apperror.NewErrorf("WAN address %s is not public", addr)
+	}
+	return addr, nil
+}
+
+func (s testWANSource) WAN(string) (string, error) { return s.wan.Load().(string), nil }
+
+// testPublicSource answers with the address in addr and counts how often it was asked
+type testPublicSource struct {
+	addr  *atomic.Value
+	calls *atomic.Int32
+}
+
+func (s testPublicSource) String() string { return "test public" }
+
+func (s testPublicSource) Address(string) (string, error) {
+	s.calls.Add(1)
+	return s.addr.Load().(string), nil
+}
+
+// newTestNATUplink registers the test sources and returns an uplink asking the WAN source first
+func newTestNATUplink(t *testing.T, name string) (*uplink, *atomic.Value, *atomic.Value, *atomic.Int32) {
+	t.Helper()
+	wan, public, calls := &atomic.Value{}, &atomic.Value{}, &atomic.Int32{}
+	RegisterSource("test-wan-"+name, func(config.AddressSource) (Source, error) {
+		return testWANSource{wan: wan}, nil
+	})
+	RegisterSource("test-public-"+name, func(config.AddressSource) (Source, error) {
+		return testPublicSource{addr: public, calls: calls}, nil
+	})
+	link := &uplink{name: name, sources: []config.AddressSource{{Type: "test-wan-" + name}, {Type: "test-public-" + name}}}
+	t.Cleanup(func() {
+		natMutex.Lock()
+		defer natMutex.Unlock()
+		delete(natResults, link.name+"/"+model.FamilyIPv4)
+	})
+	return link, wan, public, calls
+}
+
+func TestValidateAddress(t *testing.T) {
+	tests := map[string]bool{
+		"203.0.113.7":   true,
+		"100.63.255.1":  true,
+		"100.64.0.1":    false,
+		"100.127.255.1": false,
+		"100.128.0.1":   true,
+		"192.168.1.7":   false,
+		"127.0.0.1":     false,
+		"0.0.0.0":       false,
+		"fe80::1":       false,
+		"2001:db8::7":   true,
+		"hdns":          false,
+	}
+	for addr, want := range tests {
+		if got := ValidateAddress(addr); got != want {
+			t.Errorf("ValidateAddress(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestDetectNAT(t *testing.T) {
+	link, wan, public, calls := newTestNATUplink(t, "nat-test")
+
+	steps := []struct {
+		wan    string
+		public string
+		nat    string
+		calls  int32
+	}{
+		{wan: "198.51.100.7", public: "198.51.100.7", nat: model.NATNone, calls: 1},
+		// The public address is not asked again while the WAN and public address stay the same
+		{wan: "198.51.100.7", public: "198.51.100.7", nat: model.NATNone, calls: 1},
+		// An upstream NAT moved the public address while the WAN address stayed the same
+		{wan: "198.51.100.7", public: "198.51.100.9", nat: model.NATDouble, calls: 2},
+		{wan: "192.168.1.7", public: "198.51.100.9", nat: model.NATDouble, calls: 3},
+		{wan: "100.64.0.7", public: "198.51.100.9", nat: model.NATCGNAT, calls: 3},
+		{wan: "198.51.100.7", public: "198.51.100.7", nat: model.NATNone, calls: 4},
+	}
+	for i, step := range steps {
+		wan.Store(step.wan)
+		public.Store(step.public)
+		nat, got := detectNAT(link, model.FamilyIPv4, step.public)
+		if nat != step.nat || got != step.wan {
+			t.Fatalf("step %d: got %q with WAN %s, want %q with WAN %s", i+1, nat, got, step.nat, step.wan)
+		}
+		if n := calls.Load(); n != step.calls {
+			t.Fatalf("step %d: public address was asked %d times, want %d", i+1, n, step.calls)
+		}
+	}
+}
+
+func TestBehindCGNAT(t *testing.T) {
+	link, wan, public, _ := newTestNATUplink(t, "cgnat-test")
+	public.Store("198.51.100.7")
+	wan.Store("100.64.0.7")
+	// The WAN source alone detects no public address on the shared address
+	if _, err := getPublicIP(&uplink{name: link.name, sources: link.sources[:1]}, model.FamilyIPv4); err == nil {
+		t.Fatal("a carrier-grade NAT address must not be detected as public address")
+	}
+
+	got, gotWAN := behindCGNAT(link, model.FamilyIPv4)
+	if got != "198.51.100.7" || gotWAN != "100.64.0.7" {
+		t.Fatalf("got %s with WAN %s, want 198.51.100.7 with WAN 100.64.0.7", got, gotWAN)
+	}
+	if got, gotWAN := behindCGNAT(link, model.FamilyIPv6); got != "" || gotWAN != "" {
+		t.Fatalf("IPv6 has no carrier-grade NAT, got %s with WAN %s", got, gotWAN)
+	}
+
+	wan.Store("203.0.113.7")
+	if got, gotWAN := behindCGNAT(link, model.FamilyIPv4); got != "" || gotWAN != "" {
+		t.Fatalf("a public WAN address is not behind a carrier-grade NAT, got %s with WAN %s", got, gotWAN)
+	}
+}
@@ -0,0 +1,83 @@
+package dns
+
+import (
+	"net"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/hdns/pkg/config"
+)
+
+func init() {
+	RegisterSource(config.SourceInterface, func(c config.AddressSource) (Source, error) {
+		if c.Interface == "" {
+			return nil, apperror.NewError("interface name is required")
+		}
+		return &interfaceSource{name: c.Interface}, nil
+	})
+}
+
+// interfaceSource reads the public address assigned to a local network interface, e.g. ppp0 on a router
+type interfaceSource struct {
+	name string
+}
+
+func (s *interfaceSource) String() string {
+	return "interface " + s.name
+}
+
+func (s *interfaceSource) Address(family string) (string, error) {
+	addrs, err := s.addresses(family)
+	if err != nil {
+		return "", apperror.Wrap(err)
+	}
+	for _, ip := range addrs {
+		if ValidateAddress(ip) {
+			return ip, nil
+		}
+	}
+	return "", apperror.NewErrorf("network interface %s has no public %s address", s.name, family)
+}
+
+// WAN returns the address of the interface even if it is not public, e.g. a private or shared address behind another NAT
+func (s *interfaceSource) WAN(family string) (string, error) {
+	addrs, err := s.addresses(family)
+	if err != nil {
+		return "", apperror.Wrap(err)
+	}
+	for _, ip := range addrs {
+		if ValidateAddress(ip) {
+			return ip, nil
+		}
+	}
+	if len(addrs) == 0 {
+		return "", apperror.NewErrorf("network interface %s has no %s address", s.name, family)
+	}
+	return addrs[0], nil
+}
+
+// addresses lists the global unicast addresses of the family assigned to the interface
+func (s *interfaceSource) addresses(family string) ([]string, error) {
+	iface, err := net.InterfaceByName(s.name)
+	if err != nil {
+		return nil, apperror.NewErrorf("network interface %s not found", s.name).AddError(err)
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return nil, apperror.NewErrorf("network interface %s is down", s.name)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, apperror.NewErrorf("failed to list addresses of network interface %s", s.name).AddError(err)
+	}
+	ips := []string{}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || !ipnet.IP.IsGlobalUnicast() {
+			continue
+		}
+		ip := ipnet.IP.String()
+		if Family(ip) == family {
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
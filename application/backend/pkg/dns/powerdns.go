@@ -0,0 +1,199 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/go-core/version"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	powerDNSZonesPath  = "/api/v1/servers/localhost/zones"
+	powerDNSDefaultTTL = 300
+)
+
+func init() {
+	RegisterProvider("powerdns", func(c model.Credential) (Provider, error) {
+		if strings.TrimSpace(c.Endpoint) == "" {
+			return nil, apperror.NewError("the URL of the PowerDNS API is required as endpoint, e.g. http://127.0.0.1:8081")
+		}
+		return &powerDNS{baseURL: strings.TrimSuffix(c.Endpoint, "/"), APIKey: c.Token.String()}, nil
+	})
+}
+
+// powerDNS talks to the HTTP API of a PowerDNS Authoritative server
+type powerDNS struct {
+	baseURL string
+	APIKey  string
+}
+
+type powerDNSRRSet struct {
+	Name       string           `json:"name"`
+	Type       string           `json:"type"`
+	TTL        uint32           `json:"ttl,omitempty"`
+	ChangeType string           `json:"changetype,omitempty"`
+	Records    []powerDNSRecord `json:"records"`
+}
+
+type powerDNSRecord struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+func (c *powerDNS) Zones() ([]Zone, error) {
+	body, err := c.fetch(http.MethodGet, c.baseURL+powerDNSZonesPath, nil)
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
+
+	var res []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, apperror.NewError("unmarshal response failed").AddError(err)
+	}
+
+	zones := make([]Zone, 0, len(res))
+	for _, z := range res {
+		zones = append(zones, Zone{ID: z.ID, Name: strings.TrimSuffix(z.Name, ".")})
+	}
+	return zones, nil
+}
+
+func (c *powerDNS) FindRecord(zone Zone, name, recordType string) (*Record, bool, error) {
+	fqdn := recordFQDN(zone, name) + "."
+	query := url.Values{}
+	query.Set("rrset_name", fqdn)
+	query.Set("rrset_type", recordType)
+	body, err := c.fetch(http.MethodGet, fmt.Sprintf("%s?%s", c.zoneURL(zone), query.Encode()), nil)
+	if err != nil {
+		return nil, false, apperror.Wrap(err)
+	}
+
+	var res struct {
+		RRSets []powerDNSRRSet `json:"rrsets"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, false, apperror.NewError("unmarshal response failed").AddError(err)
+	}
+
+	// older PowerDNS versions ignore the rrset filter and return the whole zone
+	for _, set := range res.RRSets {
+		if !strings.EqualFold(set.Name, fqdn) || set.Type != recordType {
+			continue
+		}
+
+		rec := &Record{
+			ID:     fqdn,
+			ZoneID: zone.ID,
+			Type:   set.Type,
+			Name:   name,
+			TTL:    set.TTL,
+		}
+		for _, r := range set.Records {
+			if r.Disabled {
+				continue
+			}
+			rec.Values = append(rec.Values, r.Content)
+		}
+		if len(rec.Values) == 0 {
+			return nil, false, nil
+		}
+		rec.Value = rec.Values[0]
+		return rec, true, nil
+	}
+	return nil, false, nil
+}
+
+func (c *powerDNS) CreateRecord(zone Zone, record *Record) error {
+	if err := validateRecord(record); err != nil {
+		return err
+	}
+	return c.patch(zone, record, "REPLACE")
+}
+
+func (c *powerDNS) UpdateRecord(zone Zone, record *Record) error {
+	return c.patch(zone, record, "REPLACE")
+}
+
+func (c *powerDNS) DeleteRecord(zone Zone, record *Record) error {
+	return c.patch(zone, record, "DELETE")
+}
+
+// patch applies a single RRset change to the zone, REPLACE swaps all values of the RRset for the record value
+func (c *powerDNS) patch(zone Zone, record *Record, changeType string) error {
+	set := powerDNSRRSet{
+		Name:       recordFQDN(zone, record.Name) + ".",
+		Type:       record.Type,
+		ChangeType: changeType,
+		Records:    []powerDNSRecord{},
+	}
+	if changeType == "REPLACE" {
+		set.TTL = record.TTL
+		if set.TTL == 0 {
+			set.TTL = powerDNSDefaultTTL
+		}
+		set.Records = append(set.Records, powerDNSRecord{Content: record.Value})
+	}
+
+	data, err := json.Marshal(map[string]any{
+		"rrsets": []powerDNSRRSet{set},
+	})
+	if err != nil {
+		return apperror.NewError("marshaling the rrset change failed").AddError(err)
+	}
+	_, err = c.fetch(http.MethodPatch, c.zoneURL(zone), data)
+	if err != nil {
+		return apperror.NewErrorf("applying the %s rrset change failed", strings.ToLower(changeType)).AddError(err)
+	}
+	return nil
+}
+
+func (c *powerDNS) zoneURL(zone Zone) string {
+	id := zone.ID
+	if !strings.HasSuffix(id, ".") {
+		id += "."
+	}
+	return c.baseURL + powerDNSZonesPath + "/" + url.PathEscape(id)
+}
+
+func (c *powerDNS) fetch(method, url string, body []byte) ([]byte, error) {
+	log.Trace().Str("url", url).Str("method", method).Str("body", string(body)).Msg("HTTP request")
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, apperror.NewError("creating HTTP request failed").AddError(err)
+	}
+	req.Header.Set("User-Agent", "hdns/"+version.GitTag)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", c.APIKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, apperror.NewError("sending HTTP request failed").AddError(err)
+	}
+	defer apperror.Catch(resp.Body.Close, "failed to close response body")
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, apperror.NewError("reading response body failed").AddError(err)
+	}
+	log.Trace().Str("body", string(body)).Msg("HTTP response")
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		var res struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &res) == nil && res.Error != "" {
+			return nil, apperror.NewErrorf("HTTP request failed with status %d: %s", resp.StatusCode, res.Error)
+		}
+		return nil, apperror.NewErrorf("HTTP request failed with status %d: %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	return body, nil
+}
@@ -0,0 +1,48 @@
+package dns
+
+import (
+	"net"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+)
+
+// HostAddress combines the prefix of a detected IPv6 address with a static interface ID
+// The suffix is either an IPv6 address whose bits after the prefix length are used, like ::1234,
+// or a MAC address that is turned into a modified EUI-64 interface ID within the detected /64
+func HostAddress(detected string, prefix uint8, suffix string) (string, error) {
+	ip := net.ParseIP(detected)
+	if ip == nil || ip.To4() != nil {
+		return "", apperror.NewErrorf("%s is not an IPv6 address", detected)
+	}
+	if prefix == 0 || prefix > 64 {
+		return "", apperror.NewErrorf("invalid IPv6 prefix length /%d", prefix)
+	}
+
+	host, bits := net.ParseIP(suffix), int(prefix)
+	if mac, err := net.ParseMAC(suffix); err == nil {
+		host, bits = eui64(mac), 64
+	}
+	if host == nil || host.To4() != nil {
+		return "", apperror.NewErrorf("invalid IPv6 suffix %s", suffix)
+	}
+
+	mask := net.CIDRMask(bits, 128)
+	addr := make(net.IP, net.IPv6len)
+	for i := range addr {
+		addr[i] = ip[i]&mask[i] | host[i]&^mask[i]
+	}
+	return addr.String(), nil
+}
+
+// eui64 derives the modified EUI-64 interface ID of a 48 bit MAC address as described in RFC 4291
+func eui64(mac net.HardwareAddr) net.IP {
+	if len(mac) != 6 {
+		return nil
+	}
+	id := make(net.IP, net.IPv6len)
+	copy(id[8:11], mac[0:3])
+	id[11], id[12] = 0xff, 0xfe
+	copy(id[13:16], mac[3:6])
+	id[8] ^= 0x02
+	return id
+}
@@ -0,0 +1,132 @@
+package dns
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+)
+
+var (
+	providerMutex = &sync.RWMutex{}
+	providers     = make(map[string]ProviderFactory)
+)
+
+// Provider is a DNS backend hdns can manage records on
+type Provider interface {
+	// Zones lists all zones the credential has access to
+	Zones() ([]Zone, error)
+	// FindRecord looks up a record by name and type within a zone
+	FindRecord(zone Zone, name, recordType string) (*Record, bool, error)
+	// CreateRecord creates a new record within a zone
+	CreateRecord(zone Zone, record *Record) error
+	// UpdateRecord replaces the value and TTL of an existing record
+	UpdateRecord(zone Zone, record *Record) error
+	// DeleteRecord removes an existing record from a zone
+	DeleteRecord(zone Zone, record *Record) error
+}
+
+// BulkProvider is implemented by providers that can change many records of a zone with a single request
+// Records rejected by the provider get their Error set while the returned error reports failed requests
+type BulkProvider interface {
+	Provider
+	// ZoneRecords lists all records of a zone
+	ZoneRecords(zone Zone) ([]Record, error)
+	// CreateRecords creates all records within a zone
+	CreateRecords(zone Zone, records []*Record) error
+	// UpdateRecords replaces the value and TTL of all existing records within a zone
+	UpdateRecords(zone Zone, records []*Record) error
+}
+
+// RecordGetter is implemented by providers with stable record IDs, their records are addressed directly instead of searched by name
+type RecordGetter interface {
+	// GetRecord fetches a record by its ID, a record that no longer exists is reported as not found
+	GetRecord(zone Zone, id string) (*Record, bool, error)
+}
+
+// ProviderFactory creates a provider client for the given credential
+type ProviderFactory func(c model.Credential) (Provider, error)
+
+// RegisterProvider makes a provider available under the given name
+func RegisterProvider(name string, factory ProviderFactory) {
+	if name == "" {
+		panic("provider name cannot be empty")
+	}
+	if factory == nil {
+		panic("provider factory cannot be nil")
+	}
+
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+	providers[name] = factory
+}
+
+// NewProvider creates a client for the provider referenced by the credential
+func NewProvider(c model.Credential) (Provider, error) {
+	providerMutex.RLock()
+	factory, ok := providers[c.Provider]
+	providerMutex.RUnlock()
+	if !ok {
+		return nil, apperror.NewErrorf("unknown DNS provider %q", c.Provider)
+	}
+
+	p, err := factory(c)
+	if err != nil {
+		return nil, apperror.NewErrorf("failed to create DNS provider %s", c.Provider).AddError(err)
+	}
+	return p, nil
+}
+
+// Providers returns the names of all registered providers
+func Providers() []string {
+	providerMutex.RLock()
+	defer providerMutex.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// matchRecord returns the only record with the given name and type
+// Several matches are reported as an error instead of silently picking one of them
+func matchRecord(zone Zone, records []Record, name, recordType string) (*Record, bool, error) {
+	matches := []Record{}
+	for _, rec := range records {
+		if rec.Type == recordType && sameName(zone, rec.Name, name) {
+			matches = append(matches, rec)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, false, nil
+	case 1:
+		return &matches[0], true, nil
+	}
+	return nil, false, apperror.NewErrorf("found %d %s records named %s, remove the duplicates at the provider", len(matches), recordType, recordFQDN(zone, name))
+}
+
+// sameName reports whether two record names point to the same name within a zone
+func sameName(zone Zone, a, b string) bool {
+	return strings.EqualFold(recordFQDN(zone, a), recordFQDN(zone, b))
+}
+
+func validateRecord(r *Record) error {
+	switch {
+	case r.ZoneID == "":
+		return apperror.NewError("zone ID is required")
+	case r.Type == "":
+		return apperror.NewError("record type is required")
+	case r.Name == "":
+		return apperror.NewError("record name is required")
+	case r.Value == "":
+		return apperror.NewError("record value is required")
+	case !ValidateAddress(r.Value):
+		return apperror.NewError("record value is invalid")
+	}
+	return nil
+}
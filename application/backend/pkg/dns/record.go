@@ -0,0 +1,549 @@
+package dns
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/go-core/database"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Record is a provider independent representation of a DNS record
+type Record struct {
+	ID     string `json:"id"`
+	ZoneID string `json:"zone_id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	TTL    uint32 `json:"ttl"`
+	Error  string `json:"error"`
+	// Values holds every value of the RRSet for providers that group records by name and type
+	Values []string `json:"-"`
+	// Proxied routes the traffic through the provider, only supported by cloudflare
+	Proxied bool `json:"-"`
+	// foundTTL is the TTL the provider reported when the record was looked up, nil for records that were not looked up
+	foundTTL *uint32
+}
+
+// Zone is a DNS zone as listed by a provider
+type Zone struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	RecordsCount int    `json:"records_count"`
+}
+
+// UpdateRecord publishes the addresses to the provider of the record and all of its mirror targets
+func UpdateRecord(r *model.Record, addrs Addresses) error {
+	return publishAll(r, addrs, true)
+}
+
+func FetchRecord(r *model.Record, recordType string) (*Record, bool, error) {
+	p, err := NewProvider(r.Credential)
+	if err != nil {
+		return nil, false, apperror.Wrap(err)
+	}
+	id := r.ProviderRecordID
+	if recordType == model.RecordTypeAAAA {
+		id = r.ProviderRecordIDV6
+	}
+	rec, found, err := locate(p, zoneOf(r), id, r.Name, recordType)
+	if err != nil {
+		return nil, false, apperror.Wrap(err)
+	}
+	return rec, found, nil
+}
+
+func FetchZones(c model.Credential) ([]Zone, error) {
+	p, err := NewProvider(c)
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
+	return p.Zones()
+}
+
+// ZoneName looks up the name of a zone as reported by its provider
+func ZoneName(c model.Credential, zoneID string) (string, error) {
+	zones, err := FetchZones(c)
+	if err != nil {
+		return "", apperror.Wrap(err)
+	}
+	for _, z := range zones {
+		if z.ID == zoneID {
+			return z.Name, nil
+		}
+	}
+	return "", apperror.NewErrorf("zone %s not found on %s", zoneID, c.Provider)
+}
+
+// DeleteRecord removes all record types of the record from its provider and all of its mirror targets
+func DeleteRecord(r *model.Record) error {
+	deleted := false
+	for _, d := range destinations(r, nil) {
+		found, err := deleteFrom(d.credential(), d.zone(), d.providerRecordID(), r.Name, d.recordType)
+		if err != nil {
+			if d.target != nil {
+				return apperror.NewErrorf("failed to delete record from mirror target %s", d.target.Provider).AddError(err)
+			}
+			return apperror.Wrap(err)
+		}
+		deleted = deleted || found
+	}
+	if !deleted {
+		return apperror.NewError("record not found")
+	}
+	return nil
+}
+
+// destination is a single place a record type is published to, the record itself or one of its mirror targets
+type destination struct {
+	record     *model.Record
+	target     *model.Target
+	recordType string
+	addr       *model.Address
+	followed   bool
+	value      string
+	changed    bool
+	err        error
+}
+
+// destinations returns every record type of the record itself followed by those of its mirror targets
+// A record type without a current address of its family fails right away
+// Records following another hostname publish the addresses it resolves to instead of the detected ones
+func destinations(r *model.Record, addrs Addresses) []*destination {
+	dests := []*destination{}
+	for _, recordType := range r.Types() {
+		dests = append(dests, &destination{record: r, recordType: recordType, followed: r.Follow != ""})
+		for i := range r.Targets {
+			dests = append(dests, &destination{record: r, target: &r.Targets[i], recordType: recordType, followed: r.Follow != ""})
+		}
+	}
+	if addrs == nil {
+		return dests
+	}
+
+	var err error
+	if r.Follow != "" {
+		addrs, err = followAddresses(r.Follow)
+	}
+	for _, d := range dests {
+		if err != nil {
+			d.err = err
+			continue
+		}
+		d.addr, d.err = addrs.ForType(d.recordType)
+		if d.err != nil && d.followed {
+			d.err = apperror.NewErrorf("%s does not resolve to an %s address", r.Follow, model.FamilyOf(d.recordType))
+		}
+		if d.err == nil {
+			d.value, d.err = value(r, d.recordType, d.addr)
+		}
+	}
+	return dests
+}
+
+// value returns the content published for a record type
+// This is the detected address or, with a static IPv6 suffix, the host address within the detected prefix
+func value(r *model.Record, recordType string, addr *model.Address) (string, error) {
+	if recordType != model.RecordTypeAAAA || r.IPv6Suffix == "" {
+		return addr.IP, nil
+	}
+	return HostAddress(addr.IP, r.IPv6Prefix, r.IPv6Suffix)
+}
+
+func (d *destination) credential() model.Credential {
+	if d.target != nil {
+		return d.target.Credential
+	}
+	return d.record.Credential
+}
+
+func (d *destination) zone() Zone {
+	if d.target != nil {
+		return Zone{ID: d.target.ZoneID, Name: d.target.Domain}
+	}
+	return zoneOf(d.record)
+}
+
+// slot holds the fields of a record or target that belong to a single record type
+type slot struct {
+	providerRecordID *string
+	addressID        **uint64
+	address          **model.Address
+}
+
+func (d *destination) slot() slot {
+	v6 := d.recordType == model.RecordTypeAAAA
+	switch {
+	case d.target != nil && v6:
+		return slot{&d.target.ProviderRecordIDV6, &d.target.AddressV6ID, &d.target.AddressV6}
+	case d.target != nil:
+		return slot{&d.target.ProviderRecordID, &d.target.AddressID, &d.target.Address}
+	case v6:
+		return slot{&d.record.ProviderRecordIDV6, &d.record.AddressV6ID, &d.record.AddressV6}
+	}
+	return slot{&d.record.ProviderRecordID, &d.record.AddressID, &d.record.Address}
+}
+
+// providerRecordID returns the ID the provider assigned to the record type on the last publish
+func (d *destination) providerRecordID() string {
+	return *d.slot().providerRecordID
+}
+
+func (d *destination) setProviderRecordID(id string) {
+	*d.slot().providerRecordID = id
+}
+
+// current reports whether the provider record already holds the value and settings of the destination
+// Only cloudflare knows the proxied flag, the other providers report it as false
+// A TTL of 0 leaves the TTL to the provider, just like cloudflare does for proxied records
+func (d *destination) current(rec *Record) bool {
+	r := d.record
+	if rec.Value != d.value || len(rec.Values) > 1 {
+		return false
+	}
+	cloudflare := d.credential().Provider == "cloudflare"
+	if cloudflare && rec.Proxied != r.Proxied {
+		return false
+	}
+	if r.TTL != 0 && !(cloudflare && r.Proxied) && rec.TTL != r.TTL {
+		return false
+	}
+	return true
+}
+
+// outcome returns the status fields of the record or target
+func (d *destination) outcome() (*string, *string, *time.Time) {
+	if d.target != nil {
+		return &d.target.Status, &d.target.Error, &d.target.LastUpdate
+	}
+	return &d.record.Status, &d.record.Error, &d.record.LastUpdate
+}
+
+// reset clears the status of the record or target before the outcome of its record types is applied
+func (d *destination) reset() {
+	status, message, _ := d.outcome()
+	*status, *message = model.StatusOK, ""
+}
+
+// apply stores the outcome of the publish on the record or target
+// Failures of several record types of the same record or target are joined
+func (d *destination) apply() {
+	status, message, lastUpdate := d.outcome()
+	if d.err != nil {
+		*status = model.StatusError
+		if *message != "" {
+			*message += "; "
+		}
+		*message += d.recordType + ": " + d.err.Error()
+		return
+	}
+
+	s := d.slot()
+	if d.followed {
+		// Addresses of a followed hostname are not part of the address history
+		*s.addressID, *s.address = nil, nil
+	} else {
+		*s.addressID = &d.addr.ID
+		*s.address = d.addr
+	}
+	if !d.changed {
+		return
+	}
+	*lastUpdate = time.Now()
+	if d.target != nil {
+		log.Info().Msgf("[DNS] %s record %s.%s mirrored successfully to %s", d.recordType, d.record.Name, d.target.Domain, d.target.Provider)
+		return
+	}
+	log.Info().Msgf("[DNS] %s record %s.%s updated successfully on %s", d.recordType, d.record.Name, d.record.Domain, d.record.Provider)
+}
+
+// publishAll writes the addresses to the provider of the record and to every mirror target
+// A failing target does not stop the others, its status is stored and all failures are returned together
+func publishAll(r *model.Record, addrs Addresses, force bool) error {
+	dests := destinations(r, addrs)
+	for _, d := range dests {
+		if d.err != nil {
+			continue
+		}
+		d.changed, d.err = publish(d, force)
+	}
+	return finish(r, dests)
+}
+
+// publishMany refreshes many records at once
+// Destinations sharing a zone on a provider with bulk support are changed with a handful of requests per zone
+func publishMany(records []*model.Record, addrs Addresses) {
+	dests := make(map[*model.Record][]*destination)
+	batches := make(map[string][]*destination)
+	order := []string{}
+	for _, r := range records {
+		dests[r] = destinations(r, addrs)
+		for _, d := range dests[r] {
+			if d.err != nil {
+				continue
+			}
+			c := d.credential()
+			key := strings.Join([]string{c.Provider, c.Endpoint, c.Token.String(), d.zone().ID}, "|")
+			if _, ok := batches[key]; !ok {
+				order = append(order, key)
+			}
+			batches[key] = append(batches[key], d)
+		}
+	}
+
+	for _, key := range order {
+		batch := batches[key]
+		p, err := NewProvider(batch[0].credential())
+		if err != nil {
+			for _, d := range batch {
+				d.err = apperror.Wrap(err)
+			}
+			continue
+		}
+
+		bp, ok := p.(BulkProvider)
+		if !ok || len(batch) == 1 {
+			for _, d := range batch {
+				d.changed, d.err = publish(d, false)
+			}
+			continue
+		}
+		publishBulk(bp, batch[0].zone(), batch)
+	}
+
+	for _, r := range records {
+		err := finish(r, dests[r])
+		if err != nil {
+			log.Error().Err(err).Msgf("failed to refresh DNS record %s.%s", r.Name, r.Domain)
+		}
+	}
+}
+
+// publishBulk lists the zone once and creates or updates all outdated records of the batch with one request each
+func publishBulk(p BulkProvider, zone Zone, batch []*destination) {
+	existing, err := p.ZoneRecords(zone)
+	if err != nil {
+		for _, d := range batch {
+			d.err = apperror.Wrap(err)
+		}
+		return
+	}
+
+	creates, updates := []*Record{}, []*Record{}
+	pending := make(map[*Record]*destination)
+	for _, d := range batch {
+		r, ip := d.record, d.value
+		rec, found, err := lookup(zone, existing, d.providerRecordID(), r.Name, d.recordType)
+		if err != nil {
+			d.err = err
+			continue
+		}
+		if found {
+			d.setProviderRecordID(rec.ID)
+		}
+		if found && d.current(rec) {
+			log.Info().Msgf("[DNS] %s record %s.%s is already up-to-date with address %s on %s", d.recordType, r.Name, zone.Name, ip, d.credential().Provider)
+			continue
+		}
+
+		if !found {
+			rec = &Record{ZoneID: zone.ID, Type: d.recordType, Name: r.Name}
+		}
+		rec.Value = ip
+		rec.TTL = r.TTL
+		rec.Proxied = r.Proxied
+		rec.Error = ""
+		if !found {
+			if err := validateRecord(rec); err != nil {
+				d.err = err
+				continue
+			}
+			creates = append(creates, rec)
+		} else {
+			updates = append(updates, rec)
+		}
+		pending[rec] = d
+	}
+
+	apply := func(records []*Record, err error) {
+		for _, rec := range records {
+			d := pending[rec]
+			switch {
+			case err != nil:
+				d.err = err
+			case rec.Error != "":
+				d.err = apperror.NewError(rec.Error)
+			default:
+				d.changed = true
+				d.setProviderRecordID(rec.ID)
+			}
+		}
+	}
+	if len(creates) > 0 {
+		apply(creates, p.CreateRecords(zone, creates))
+	}
+	if len(updates) > 0 {
+		apply(updates, p.UpdateRecords(zone, updates))
+	}
+}
+
+// finish stores the outcome of all destinations of a record and returns the combined failures
+func finish(r *model.Record, dests []*destination) error {
+	failures := apperror.NewErrorf("failed to update DNS record %s.%s", r.Name, r.Domain)
+	failed := 0
+	for _, d := range dests {
+		d.reset()
+	}
+	for _, d := range dests {
+		d.apply()
+		if d.err == nil {
+			continue
+		}
+		failed++
+		if d.target != nil {
+			failures.AddError(apperror.NewErrorf("mirror %s %s: %s", d.target.Provider, d.recordType, d.err.Error()))
+			continue
+		}
+		failures.AddError(apperror.NewErrorf("%s %s: %s", r.Provider, d.recordType, d.err.Error()))
+	}
+
+	// The addresses are only referenced by their IDs, saving them with the record would upsert stale rows
+	err := database.Execute(func(db *gorm.DB) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Omit(clause.Associations).Save(r).Error
+			if err != nil {
+				return err
+			}
+			for i := range r.Targets {
+				err := tx.Omit(clause.Associations).Save(&r.Targets[i]).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return apperror.NewErrorf("failed to update DNS record %s.%s in database", r.Name, r.Domain).AddError(err)
+	}
+
+	if failed > 0 {
+		log.Warn().Msgf("[DNS] %d of %d targets of record %s.%s failed to update", failed, len(dests), r.Name, r.Domain)
+		return failures
+	}
+	return nil
+}
+
+// publish writes the address to a single destination and reports whether the record had to be changed
+func publish(d *destination, force bool) (bool, error) {
+	c, zone, r, ip := d.credential(), d.zone(), d.record, d.value
+	p, err := NewProvider(c)
+	if err != nil {
+		return false, apperror.Wrap(err)
+	}
+	rec, found, err := locate(p, zone, d.providerRecordID(), r.Name, d.recordType)
+	if err != nil {
+		return false, apperror.Wrap(err)
+	}
+
+	if found {
+		d.setProviderRecordID(rec.ID)
+	}
+	if found && !force && d.current(rec) {
+		log.Info().Msgf("[DNS] %s record %s.%s is already up-to-date with address %s on %s", d.recordType, r.Name, zone.Name, ip, c.Provider)
+		return false, nil
+	}
+
+	if !found {
+		newRecord := &Record{
+			ZoneID:  zone.ID,
+			Type:    d.recordType,
+			Name:    r.Name,
+			TTL:     r.TTL,
+			Value:   ip,
+			Proxied: r.Proxied,
+		}
+		err = p.CreateRecord(zone, newRecord)
+		if err != nil {
+			return false, apperror.Wrap(err)
+		}
+		d.setProviderRecordID(newRecord.ID)
+		return true, nil
+	}
+
+	rec.Value = ip
+	rec.TTL = r.TTL
+	rec.Proxied = r.Proxied
+	err = p.UpdateRecord(zone, rec)
+	if err != nil {
+		return false, apperror.Wrap(err)
+	}
+	return true, nil
+}
+
+// deleteFrom removes a record type from a provider and reports whether it existed
+func deleteFrom(c model.Credential, zone Zone, id, name, recordType string) (bool, error) {
+	p, err := NewProvider(c)
+	if err != nil {
+		return false, apperror.Wrap(err)
+	}
+	rec, found, err := locate(p, zone, id, name, recordType)
+	if err != nil {
+		return false, apperror.Wrap(err)
+	}
+	if !found {
+		return false, nil
+	}
+	return true, p.DeleteRecord(zone, rec)
+}
+
+// locate finds a record at its provider, by the stored provider ID when the provider supports it
+// The zone is only searched by name and type when there is no ID or the record behind it is gone
+func locate(p Provider, zone Zone, id, name, recordType string) (*Record, bool, error) {
+	getter, ok := p.(RecordGetter)
+	if ok && id != "" {
+		rec, found, err := getter.GetRecord(zone, id)
+		if err != nil {
+			return nil, false, apperror.Wrap(err)
+		}
+		if found && rec.Type == recordType && sameName(zone, rec.Name, name) {
+			return rec, true, nil
+		}
+		log.Warn().Msgf("[DNS] record %s with ID %s is gone, searching the zone by name", recordFQDN(zone, name), id)
+	}
+	return p.FindRecord(zone, name, recordType)
+}
+
+// lookup is the counterpart of locate for an already listed zone
+func lookup(zone Zone, records []Record, id, name, recordType string) (*Record, bool, error) {
+	if id != "" {
+		for _, rec := range records {
+			if rec.ID == id && rec.Type == recordType && sameName(zone, rec.Name, name) {
+				return &rec, true, nil
+			}
+		}
+	}
+	return matchRecord(zone, records, name, recordType)
+}
+
+// zoneOf returns the zone a record belongs to
+func zoneOf(r *model.Record) Zone {
+	return Zone{ID: r.ZoneID, Name: r.Domain}
+}
+
+// recordFQDN builds the fully qualified name of a record within its zone without the trailing dot
+func recordFQDN(zone Zone, name string) string {
+	domain := zone.Name
+	if domain == "" {
+		domain = zone.ID
+	}
+	domain = strings.TrimSuffix(domain, ".")
+	if name == "" || name == "@" {
+		return domain
+	}
+	return name + "." + domain
+}
@@ -0,0 +1,85 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+)
+
+func TestDestinationCurrent(t *testing.T) {
+	cloudflare := model.Credential{Provider: "cloudflare"}
+	hetzner := model.Credential{Provider: "hetzner"}
+	tests := []struct {
+		name   string
+		record model.Record
+		target *model.Target
+		rec    Record
+		want   bool
+	}{
+		{
+			name:   "same value",
+			record: model.Record{Credential: hetzner},
+			rec:    Record{Value: "203.0.113.1"},
+			want:   true,
+		},
+		{
+			name:   "other value",
+			record: model.Record{Credential: hetzner},
+			rec:    Record{Value: "203.0.113.2"},
+		},
+		{
+			name:   "several values",
+			record: model.Record{Credential: hetzner},
+			rec:    Record{Value: "203.0.113.1", Values: []string{"203.0.113.1", "203.0.113.2"}},
+		},
+		{
+			name:   "proxied switched off",
+			record: model.Record{Credential: cloudflare},
+			rec:    Record{Value: "203.0.113.1", Proxied: true},
+		},
+		{
+			name:   "proxied switched on",
+			record: model.Record{Credential: cloudflare, Proxied: true},
+			rec:    Record{Value: "203.0.113.1"},
+		},
+		{
+			name:   "other TTL",
+			record: model.Record{Credential: hetzner, TTL: 60},
+			rec:    Record{Value: "203.0.113.1", TTL: 300},
+		},
+		{
+			name:   "same TTL",
+			record: model.Record{Credential: hetzner, TTL: 60},
+			rec:    Record{Value: "203.0.113.1", TTL: 60},
+			want:   true,
+		},
+		{
+			name:   "TTL left to the provider",
+			record: model.Record{Credential: hetzner},
+			rec:    Record{Value: "203.0.113.1", TTL: 300},
+			want:   true,
+		},
+		{
+			name:   "automatic TTL of proxied records",
+			record: model.Record{Credential: cloudflare, TTL: 60, Proxied: true},
+			rec:    Record{Value: "203.0.113.1", TTL: 1, Proxied: true},
+			want:   true,
+		},
+		{
+			name:   "proxied is ignored by other providers",
+			record: model.Record{Credential: cloudflare, Proxied: true},
+			target: &model.Target{Credential: hetzner},
+			rec:    Record{Value: "203.0.113.1"},
+			want:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &destination{record: &tt.record, target: tt.target, recordType: model.RecordTypeA, value: "203.0.113.1"}
+			if got := d.current(&tt.rec); got != tt.want {
+				t.Fatalf("current = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package dns
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -35,6 +36,14 @@ func NewDNSResolver() *Resolver {
 	}
 }
 
+// NewDNSResolverFor creates a new DNS resolver querying the given servers
+func NewDNSResolverFor(servers []string) *Resolver {
+	return &Resolver{
+		servers: servers,
+		timeout: 5 * time.Second,
+	}
+}
+
 // Resolve resolves a domain against all configured DNS servers concurrently
 func (r *Resolver) Resolve(domain string) ([]Resolution, error) {
 	if len(r.servers) == 0 {
@@ -44,27 +53,36 @@ func (r *Resolver) Resolve(domain string) ([]Resolution, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
 	defer cancel()
 
+	// Servers that failed repeatedly are skipped during their cool-down, unless no other server is left
+	skipped := map[string]time.Time{}
+	for _, server := range r.servers {
+		if until, ok := coolingDown(model.HealthDNS, "", server); ok {
+			skipped[server] = until
+		}
+	}
+	if len(skipped) == len(r.servers) {
+		skipped = map[string]time.Time{}
+	}
+
 	results := make([]Resolution, len(r.servers))
 	var wg sync.WaitGroup
 
 	for i, server := range r.servers {
+		if until, ok := skipped[server]; ok {
+			results[i] = Resolution{
+				Server: server,
+				Error:  fmt.Sprintf("skipped after repeated failures until %s", until.Format(time.TimeOnly)),
+			}
+			continue
+		}
 		wg.Add(1)
 		go func(index int, dnsServer string) {
 			defer wg.Done()
 
 			start := time.Now()
-			resolver := &net.Resolver{
-				PreferGo: true,
-				Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-					d := net.Dialer{
-						Timeout: 2 * time.Second,
-					}
-					return d.DialContext(ctx, "udp", dnsServer)
-				},
-			}
-
-			ips, err := resolver.LookupHost(ctx, domain)
+			ips, err := dialResolver(nil, "udp", dnsServer).LookupHost(ctx, domain)
 			responseTime := time.Since(start)
+			observe(model.HealthDNS, "", dnsServer, responseTime, dnsFailure(err))
 
 			addresses := make([]string, 0, len(ips))
 			for _, ip := range ips {
@@ -111,6 +129,26 @@ func (r *Resolver) Resolve(domain string) ([]Resolution, error) {
 	return results, nil
 }
 
+// dnsFailure returns lookup errors that say something about the server
+// A name that does not exist is a valid answer and does not count against the server
+func dnsFailure(err error) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil
+	}
+	return err
+}
+
+// dialResolver creates a resolver that sends all queries to the given server through the uplink instead of the system resolvers
+func dialResolver(link *uplink, network, server string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return link.dialer(network, 2*time.Second).DialContext(ctx, network, server)
+		},
+	}
+}
+
 // buildDomain constructs the full domain name from record name and domain
 func (r *Resolver) BuildDomain(record *model.Record) string {
 	domain := record.Domain
@@ -0,0 +1,252 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+	miekg "github.com/miekg/dns"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	rfc2136DefaultTTL = 300
+	rfc2136Fudge      = 300
+)
+
+func init() {
+	RegisterProvider("rfc2136", newRFC2136)
+}
+
+// rfc2136 sends TSIG signed DNS UPDATE messages (RFC 2136) to a primary name server
+// The endpoint has the form "server[:port]/zone[,zone...]" since the protocol has no way to list zones
+// The token uses the nsupdate notation "[algorithm:]keyname:secret" with hmac-sha256 as default algorithm
+type rfc2136 struct {
+	server    string
+	zones     []string
+	keyName   string
+	algorithm string
+	secret    string
+	timeout   time.Duration
+}
+
+func newRFC2136(c model.Credential) (Provider, error) {
+	server, zones, _ := strings.Cut(c.Endpoint, "/")
+	if strings.TrimSpace(server) == "" {
+		return nil, apperror.NewError("a primary server is required as endpoint, e.g. ns1.example.com:53/example.com")
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	p := &rfc2136{
+		server:  server,
+		timeout: 5 * time.Second,
+	}
+	for _, zone := range strings.Split(zones, ",") {
+		zone = strings.TrimSuffix(strings.TrimSpace(zone), ".")
+		if zone != "" {
+			p.zones = append(p.zones, zone)
+		}
+	}
+
+	parts := strings.Split(c.Token.String(), ":")
+	switch len(parts) {
+	case 2:
+		p.algorithm, p.keyName, p.secret = miekg.HmacSHA256, parts[0], parts[1]
+	case 3:
+		p.keyName, p.secret = parts[1], parts[2]
+		switch strings.ToLower(strings.TrimSuffix(parts[0], ".")) {
+		case "hmac-sha256":
+			p.algorithm = miekg.HmacSHA256
+		case "hmac-sha512":
+			p.algorithm = miekg.HmacSHA512
+		default:
+			return nil, apperror.NewErrorf("unsupported TSIG algorithm %s", parts[0])
+		}
+	default:
+		return nil, apperror.NewError("the TSIG key must have the form [algorithm:]keyname:secret")
+	}
+	p.keyName = miekg.CanonicalName(p.keyName)
+	return p, nil
+}
+
+// Zones returns the zones configured on the endpoint after checking the server is authoritative for them
+func (c *rfc2136) Zones() ([]Zone, error) {
+	if len(c.zones) == 0 {
+		return nil, apperror.NewError("no zones configured, append them to the endpoint, e.g. ns1.example.com:53/example.com")
+	}
+
+	zones := make([]Zone, 0, len(c.zones))
+	for _, zone := range c.zones {
+		m := new(miekg.Msg)
+		m.SetQuestion(miekg.Fqdn(zone), miekg.TypeSOA)
+		res, err := c.exchange(m)
+		if err != nil {
+			return nil, apperror.NewErrorf("failed to query SOA of zone %s", zone).AddError(err)
+		}
+		if !res.Authoritative {
+			return nil, apperror.NewErrorf("server %s is not authoritative for zone %s", c.server, zone)
+		}
+		zones = append(zones, Zone{ID: zone, Name: zone})
+	}
+	return zones, nil
+}
+
+func (c *rfc2136) FindRecord(zone Zone, name, recordType string) (*Record, bool, error) {
+	rrtype, ok := miekg.StringToType[recordType]
+	if !ok {
+		return nil, false, apperror.NewErrorf("unsupported record type %s", recordType)
+	}
+
+	m := new(miekg.Msg)
+	m.SetQuestion(c.fqdn(zone, name), rrtype)
+	m.RecursionDesired = false
+	res, err := c.exchange(m)
+	if err != nil {
+		return nil, false, apperror.Wrap(err)
+	}
+
+	rec := &Record{
+		ID:     c.fqdn(zone, name),
+		ZoneID: zone.ID,
+		Type:   recordType,
+		Name:   name,
+	}
+	for _, rr := range res.Answer {
+		if rr.Header().Rrtype != rrtype {
+			continue
+		}
+		rec.TTL = rr.Header().Ttl
+		switch v := rr.(type) {
+		case *miekg.A:
+			rec.Values = append(rec.Values, v.A.String())
+		case *miekg.AAAA:
+			rec.Values = append(rec.Values, v.AAAA.String())
+		}
+	}
+	if len(rec.Values) == 0 {
+		return nil, false, nil
+	}
+	rec.Value = rec.Values[0]
+	return rec, true, nil
+}
+
+func (c *rfc2136) CreateRecord(zone Zone, record *Record) error {
+	if err := validateRecord(record); err != nil {
+		return err
+	}
+	return c.replace(zone, record)
+}
+
+func (c *rfc2136) UpdateRecord(zone Zone, record *Record) error {
+	return c.replace(zone, record)
+}
+
+func (c *rfc2136) DeleteRecord(zone Zone, record *Record) error {
+	rr, err := c.rr(zone, record)
+	if err != nil {
+		return apperror.Wrap(err)
+	}
+
+	m := new(miekg.Msg)
+	m.SetUpdate(miekg.Fqdn(c.zoneName(zone)))
+	m.RemoveRRset([]miekg.RR{rr})
+	return c.update(m)
+}
+
+// replace swaps the whole RRset of the record for the single record value
+func (c *rfc2136) replace(zone Zone, record *Record) error {
+	rr, err := c.rr(zone, record)
+	if err != nil {
+		return apperror.Wrap(err)
+	}
+
+	m := new(miekg.Msg)
+	m.SetUpdate(miekg.Fqdn(c.zoneName(zone)))
+	m.RemoveRRset([]miekg.RR{rr})
+	m.Insert([]miekg.RR{rr})
+	return c.update(m)
+}
+
+func (c *rfc2136) update(m *miekg.Msg) error {
+	res, err := c.exchange(m)
+	if err != nil {
+		return apperror.NewError("sending the DNS update failed").AddError(err)
+	}
+	if res.Rcode != miekg.RcodeSuccess {
+		return apperror.NewErrorf("DNS update rejected by %s: %s", c.server, miekg.RcodeToString[res.Rcode])
+	}
+	return nil
+}
+
+func (c *rfc2136) exchange(m *miekg.Msg) (*miekg.Msg, error) {
+	m.SetTsig(c.keyName, c.algorithm, rfc2136Fudge, time.Now().Unix())
+	client := &miekg.Client{
+		Net:        "udp",
+		Timeout:    c.timeout,
+		TsigSecret: map[string]string{c.keyName: c.secret},
+	}
+
+	log.Trace().Str("server", c.server).Str("message", m.String()).Msg("DNS request")
+	res, _, err := client.Exchange(m, c.server)
+	if err == nil && res.Truncated {
+		client.Net = "tcp"
+		res, _, err = client.Exchange(m, c.server)
+	}
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
+	log.Trace().Str("server", c.server).Str("message", res.String()).Msg("DNS response")
+
+	if res.Rcode == miekg.RcodeNotAuth || res.Rcode == miekg.RcodeRefused {
+		return nil, apperror.NewErrorf("server %s refused the request: %s", c.server, miekg.RcodeToString[res.Rcode])
+	}
+	return res, nil
+}
+
+func (c *rfc2136) rr(zone Zone, record *Record) (miekg.RR, error) {
+	ttl := record.TTL
+	if ttl == 0 {
+		ttl = rfc2136DefaultTTL
+	}
+
+	hdr := miekg.RR_Header{
+		Name:  c.fqdn(zone, record.Name),
+		Class: miekg.ClassINET,
+		Ttl:   ttl,
+	}
+	ip := net.ParseIP(record.Value)
+	switch record.Type {
+	case "A":
+		hdr.Rrtype = miekg.TypeA
+		if record.Value == "" {
+			return &miekg.A{Hdr: hdr}, nil
+		}
+		if ip == nil || ip.To4() == nil {
+			return nil, apperror.NewErrorf("invalid IPv4 address %s", record.Value)
+		}
+		return &miekg.A{Hdr: hdr, A: ip.To4()}, nil
+	case "AAAA":
+		hdr.Rrtype = miekg.TypeAAAA
+		if record.Value == "" {
+			return &miekg.AAAA{Hdr: hdr}, nil
+		}
+		if ip == nil {
+			return nil, apperror.NewErrorf("invalid IPv6 address %s", record.Value)
+		}
+		return &miekg.AAAA{Hdr: hdr, AAAA: ip}, nil
+	}
+	return nil, apperror.NewErrorf("unsupported record type %s", record.Type)
+}
+
+func (c *rfc2136) zoneName(zone Zone) string {
+	return recordFQDN(zone, "@")
+}
+
+// fqdn builds the fully qualified owner name of a record within its zone
+func (c *rfc2136) fqdn(zone Zone, name string) string {
+	return miekg.Fqdn(recordFQDN(zone, name))
+}
@@ -0,0 +1,273 @@
+package dns
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+	miekg "github.com/miekg/dns"
+)
+
+const (
+	testTSIGKey    = "hdns."
+	testTSIGSecret = "c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0"
+)
+
+// testNameServer is an in-process primary for example.com that applies TSIG signed updates
+type testNameServer struct {
+	addr    string
+	mutex   sync.Mutex
+	records map[string][]miekg.RR
+	updates int
+}
+
+func newTestNameServer(t *testing.T) *testNameServer {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	ns := &testNameServer{addr: conn.LocalAddr().String(), records: map[string][]miekg.RR{}}
+	server := &miekg.Server{
+		PacketConn: conn,
+		TsigSecret: map[string]string{testTSIGKey: testTSIGSecret},
+		Handler:    miekg.HandlerFunc(ns.serve),
+		// The default accept function answers updates with NOTIMP
+		MsgAcceptFunc: func(dh miekg.Header) miekg.MsgAcceptAction {
+			if int(dh.Bits>>11)&0xF == miekg.OpcodeUpdate {
+				return miekg.MsgAccept
+			}
+			return miekg.DefaultMsgAcceptFunc(dh)
+		},
+	}
+	started := make(chan struct{})
+	server.NotifyStartedFunc = func() { close(started) }
+	go func() { _ = server.ActivateAndServe() }()
+	<-started
+	t.Cleanup(func() { _ = server.Shutdown() })
+	return ns
+}
+
+func (ns *testNameServer) add(rrs ...string) {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+	for _, s := range rrs {
+		rr, _ := miekg.NewRR(s)
+		key := rrKey(rr.Header().Name, rr.Header().Rrtype)
+		ns.records[key] = append(ns.records[key], rr)
+	}
+}
+
+func (ns *testNameServer) values(name string, rrtype uint16) []string {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+	values := []string{}
+	for _, rr := range ns.records[rrKey(name, rrtype)] {
+		switch v := rr.(type) {
+		case *miekg.A:
+			values = append(values, v.A.String())
+		case *miekg.AAAA:
+			values = append(values, v.AAAA.String())
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+func (ns *testNameServer) updateCount() int {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+	return ns.updates
+}
+
+func (ns *testNameServer) serve(w miekg.ResponseWriter, r *miekg.Msg) {
+	m := new(miekg.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	if tsig := r.IsTsig(); tsig != nil {
+		if w.TsigStatus() != nil {
+			m.SetRcode(r, miekg.RcodeNotAuth)
+			_ = w.WriteMsg(m)
+			return
+		}
+		m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, 300, time.Now().Unix())
+	}
+
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+	switch r.Opcode {
+	case miekg.OpcodeQuery:
+		q := r.Question[0]
+		if q.Qtype == miekg.TypeSOA && q.Name == "example.com." {
+			soa, _ := miekg.NewRR("example.com. 300 IN SOA ns1.example.com. admin.example.com. 1 3600 600 86400 300")
+			m.Answer = append(m.Answer, soa)
+			break
+		}
+		if q.Name != "example.com." && !miekg.IsSubDomain("example.com.", q.Name) {
+			m.Authoritative = false
+			m.SetRcode(r, miekg.RcodeRefused)
+			break
+		}
+		m.Answer = append(m.Answer, ns.records[rrKey(q.Name, q.Qtype)]...)
+	case miekg.OpcodeUpdate:
+		ns.updates++
+		for _, rr := range r.Ns {
+			h := rr.Header()
+			key := rrKey(h.Name, h.Rrtype)
+			switch h.Class {
+			case miekg.ClassANY:
+				delete(ns.records, key)
+			case miekg.ClassINET:
+				ns.records[key] = append(ns.records[key], rr)
+			}
+		}
+	}
+	_ = w.WriteMsg(m)
+}
+
+func rrKey(name string, rrtype uint16) string {
+	return miekg.CanonicalName(name) + "/" + miekg.TypeToString[rrtype]
+}
+
+func TestRFC2136Credential(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  string
+		token     string
+		server    string
+		zones     []string
+		keyName   string
+		algorithm string
+		wantErr   bool
+	}{
+		{
+			name:      "default port and algorithm",
+			endpoint:  "ns1.example.com/example.com, example.org.",
+			token:     "hdns:secret",
+			server:    "ns1.example.com:53",
+			zones:     []string{"example.com", "example.org"},
+			keyName:   "hdns.",
+			algorithm: miekg.HmacSHA256,
+		},
+		{
+			name:      "port and algorithm",
+			endpoint:  "127.0.0.1:5353/example.com",
+			token:     "hmac-sha512:hdns.:secret",
+			server:    "127.0.0.1:5353",
+			zones:     []string{"example.com"},
+			keyName:   "hdns.",
+			algorithm: miekg.HmacSHA512,
+		},
+		{
+			name:      "ipv6 server without zones",
+			endpoint:  "[2001:db8::53]:53",
+			token:     "HMAC-SHA256.:hdns:secret",
+			server:    "[2001:db8::53]:53",
+			keyName:   "hdns.",
+			algorithm: miekg.HmacSHA256,
+		},
+		{name: "missing server", endpoint: "/example.com", token: "hdns:secret", wantErr: true},
+		{name: "unsupported algorithm", endpoint: "ns1.example.com/example.com", token: "hmac-md5:hdns:secret", wantErr: true},
+		{name: "missing secret", endpoint: "ns1.example.com/example.com", token: "hdns", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newRFC2136(model.Credential{Provider: "rfc2136", Endpoint: tt.endpoint, Token: model.Token(tt.token)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			c := p.(*rfc2136)
+			if c.server != tt.server || c.keyName != tt.keyName || c.algorithm != tt.algorithm || c.secret != "secret" {
+				t.Fatalf("got server %s key %s algorithm %s secret %s", c.server, c.keyName, c.algorithm, c.secret)
+			}
+			if len(c.zones) != len(tt.zones) {
+				t.Fatalf("got zones %v, want %v", c.zones, tt.zones)
+			}
+			for i := range tt.zones {
+				if c.zones[i] != tt.zones[i] {
+					t.Fatalf("got zones %v, want %v", c.zones, tt.zones)
+				}
+			}
+		})
+	}
+}
+
+func TestRFC2136RoundTrip(t *testing.T) {
+	ns := newTestNameServer(t)
+	ns.add("home.example.com. 60 IN A 198.51.100.1", "home.example.com. 60 IN A 198.51.100.2")
+
+	p, err := newRFC2136(model.Credential{Provider: "rfc2136", Endpoint: ns.addr + "/example.com", Token: testTSIGKey + ":" + testTSIGSecret})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	zones, err := p.Zones()
+	if err != nil || len(zones) != 1 || zones[0].Name != "example.com" {
+		t.Fatalf("zones = %v, %v", zones, err)
+	}
+	zone := zones[0]
+
+	found, ok, err := p.FindRecord(zone, "home", "A")
+	if err != nil || !ok {
+		t.Fatalf("existing record not found: %v", err)
+	}
+	if len(found.Values) != 2 || found.TTL != 60 {
+		t.Fatalf("found %+v, want both values with TTL 60", found)
+	}
+
+	// An update replaces the whole RRset with the single value
+	found.Value = "203.0.113.1"
+	if err := p.UpdateRecord(zone, found); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if got := ns.values("home.example.com.", miekg.TypeA); len(got) != 1 || got[0] != "203.0.113.1" {
+		t.Fatalf("RRset is %v after the update, want [203.0.113.1]", got)
+	}
+
+	created := &Record{ZoneID: zone.ID, Type: "AAAA", Name: "@", Value: "2001:db8::1"}
+	if err := p.CreateRecord(zone, created); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	found, ok, err = p.FindRecord(zone, "@", "AAAA")
+	if err != nil || !ok || found.Value != "2001:db8::1" || found.TTL != rfc2136DefaultTTL {
+		t.Fatalf("created record = %+v %v %v", found, ok, err)
+	}
+
+	if err := p.DeleteRecord(zone, found); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, ok, _ := p.FindRecord(zone, "@", "AAAA"); ok {
+		t.Fatal("deleted record still exists")
+	}
+	if n := ns.updateCount(); n != 3 {
+		t.Fatalf("server received %d updates, want 3", n)
+	}
+}
+
+func TestRFC2136Unauthorized(t *testing.T) {
+	ns := newTestNameServer(t)
+	p, err := newRFC2136(model.Credential{Provider: "rfc2136", Endpoint: ns.addr + "/example.com", Token: testTSIGKey + ":d3Jvbmc="})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	record := &Record{ZoneID: "example.com", Type: "A", Name: "home", Value: "203.0.113.1"}
+	if err := p.UpdateRecord(Zone{ID: "example.com", Name: "example.com"}, record); err == nil {
+		t.Fatal("an update signed with the wrong secret has to fail")
+	}
+	if n := ns.updateCount(); n != 0 {
+		t.Fatalf("server applied %d updates signed with the wrong secret", n)
+	}
+
+	_, err = p.Zones()
+	if err == nil {
+		t.Fatal("zones signed with the wrong secret have to fail")
+	}
+}
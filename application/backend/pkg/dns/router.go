@@ -0,0 +1,353 @@
+package dns
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/go-core/version"
+	"github.com/Valentin-Kaiser/hdns/pkg/config"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// tr064Location is the device description of a FRITZ!Box in its default network
+	tr064Location = "http://fritz.box:49000/tr64desc.xml"
+	ssdpAddress   = "239.255.255.250:1900"
+)
+
+var routerClient = &http.Client{Timeout: 10 * time.Second}
+
+func init() {
+	RegisterSource(config.SourceUPnP, func(c config.AddressSource) (Source, error) {
+		return &routerSource{
+			kind:     config.SourceUPnP,
+			location: c.URL,
+			username: c.Username,
+			password: c.Password,
+			services: []string{
+				"urn:schemas-upnp-org:service:WANIPConnection:",
+				"urn:schemas-upnp-org:service:WANPPPConnection:",
+			},
+		}, nil
+	})
+	RegisterSource(config.SourceTR064, func(c config.AddressSource) (Source, error) {
+		location := c.URL
+		if location == "" {
+			location = tr064Location
+		}
+		return &routerSource{
+			kind:     config.SourceTR064,
+			location: location,
+			username: c.Username,
+			password: c.Password,
+			services: []string{
+				"urn:dslforum-org:service:WANIPConnection:",
+				"urn:dslforum-org:service:WANPPPConnection:",
+			},
+		}, nil
+	})
+}
+
+// routerSource asks the home router for its WAN address with a SOAP call
+// UPnP internet gateway devices and the TR-064 interface of a FRITZ!Box share the same protocol
+type routerSource struct {
+	kind     string
+	location string
+	username string
+	password string
+	// services are the prefixes of the service types that know the external address, in order of preference
+	services []string
+}
+
+type upnpDescription struct {
+	URLBase string     `xml:"URLBase"`
+	Device  upnpDevice `xml:"device"`
+}
+
+type upnpDevice struct {
+	Services []upnpService `xml:"serviceList>service"`
+	Devices  []upnpDevice  `xml:"deviceList>device"`
+}
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+func (s *routerSource) String() string {
+	if s.location == "" {
+		return s.kind + " router"
+	}
+	return s.kind + " router " + s.location
+}
+
+func (s *routerSource) Address(family string) (string, error) {
+	addr, err := s.WAN(family)
+	if err != nil {
+		return "", apperror.Wrap(err)
+	}
+	if !ValidateAddress(addr) {
+		return "", apperror.NewErrorf("router reported the non public %s address %s", family, addr)
+	}
+	return addr, nil
+}
+
+// WAN returns the address the router reports for its WAN connection even if it is not public
+func (s *routerSource) WAN(family string) (string, error) {
+	action, field := "GetExternalIPAddress", "NewExternalIPAddress"
+	if family == model.FamilyIPv6 {
+		// Only AVM routers report their IPv6 WAN address, with a vendor specific action
+		action, field = "X_AVM_DE_GetExternalIPv6Address", "NewExternalIPv6Address"
+	}
+
+	location := s.location
+	if location == "" {
+		discovered, err := discoverGateway(3 * time.Second)
+		if err != nil {
+			return "", apperror.Wrap(err)
+		}
+		location = discovered
+	}
+
+	service, controlURL, err := s.service(location)
+	if err != nil {
+		return "", apperror.Wrap(err)
+	}
+	addr, err := s.call(controlURL, service, action, field)
+	if err != nil {
+		return "", apperror.Wrap(err)
+	}
+	if net.ParseIP(addr) == nil || Family(addr) != family {
+		return "", apperror.NewErrorf("router reported the invalid %s address %q", family, addr)
+	}
+	return addr, nil
+}
+
+// service reads the device description and returns the WAN connection service and its absolute control URL
+func (s *routerSource) service(location string) (string, string, error) {
+	body, err := s.request(http.MethodGet, location, nil, nil)
+	if err != nil {
+		return "", "", apperror.NewErrorf("failed to read device description %s", location).AddError(err)
+	}
+	var desc upnpDescription
+	if err := xml.Unmarshal(body, &desc); err != nil {
+		return "", "", apperror.NewErrorf("failed to parse device description %s", location).AddError(err)
+	}
+
+	base, err := url.Parse(location)
+	if err != nil {
+		return "", "", apperror.NewErrorf("invalid device description URL %s", location).AddError(err)
+	}
+	if desc.URLBase != "" {
+		if b, err := url.Parse(desc.URLBase); err == nil {
+			base = b
+		}
+	}
+
+	for _, prefix := range s.services {
+		service, ok := findService(desc.Device, prefix)
+		if !ok {
+			continue
+		}
+		control, err := base.Parse(service.ControlURL)
+		if err != nil {
+			return "", "", apperror.NewErrorf("invalid control URL %s", service.ControlURL).AddError(err)
+		}
+		return service.ServiceType, control.String(), nil
+	}
+	return "", "", apperror.NewErrorf("device %s has no WAN connection service", location)
+}
+
+// findService searches a device and its embedded devices for a service type with the given prefix
+func findService(device upnpDevice, prefix string) (upnpService, bool) {
+	for _, service := range device.Services {
+		if strings.HasPrefix(service.ServiceType, prefix) {
+			return service, true
+		}
+	}
+	for _, d := range device.Devices {
+		if service, ok := findService(d, prefix); ok {
+			return service, true
+		}
+	}
+	return upnpService{}, false
+}
+
+// call invokes a SOAP action without arguments and returns the value of a single response field
+func (s *routerSource) call(controlURL, service, action, field string) (string, error) {
+	envelope := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>`+
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">`+
+		`<s:Body><u:%s xmlns:u="%s"></u:%s></s:Body></s:Envelope>`, action, service, action)
+	headers := map[string]string{
+		"Content-Type": `text/xml; charset="utf-8"`,
+		"SOAPAction":   fmt.Sprintf(`"%s#%s"`, service, action),
+	}
+	body, err := s.request(http.MethodPost, controlURL, []byte(envelope), headers)
+	if err != nil {
+		if fault := soapField(body, "errorDescription") + soapField(body, "faultstring"); fault != "" {
+			return "", apperror.NewErrorf("SOAP action %s failed: %s", action, fault).AddError(err)
+		}
+		return "", apperror.NewErrorf("SOAP action %s failed", action).AddError(err)
+	}
+	value := strings.TrimSpace(soapField(body, field))
+	if value == "" {
+		return "", apperror.NewErrorf("SOAP response of %s has no %s", action, field)
+	}
+	return value, nil
+}
+
+// request sends a request to the router and answers a digest challenge when credentials are configured
+// The body is returned for failed requests too so SOAP faults can be read
+func (s *routerSource) request(method, target string, body []byte, headers map[string]string) ([]byte, error) {
+	send := func(authorization string) (*http.Response, error) {
+		req, err := http.NewRequest(method, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, apperror.NewError("creating HTTP request failed").AddError(err)
+		}
+		req.Header.Set("User-Agent", "hdns/"+version.GitTag)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		log.Trace().Str("url", target).Str("method", method).Str("body", string(body)).Msg("HTTP request")
+		return routerClient.Do(req)
+	}
+
+	resp, err := send("")
+	if err != nil {
+		return nil, apperror.NewError("sending HTTP request failed").AddError(err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized && s.username != "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		apperror.Catch(resp.Body.Close, "failed to close response body")
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, apperror.NewErrorf("invalid URL %s", target).AddError(err)
+		}
+		resp, err = send(digestAuthorization(challenge, method, u.RequestURI(), s.username, s.password))
+		if err != nil {
+			return nil, apperror.NewError("sending HTTP request failed").AddError(err)
+		}
+	}
+	defer apperror.Catch(resp.Body.Close, "failed to close response body")
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, apperror.NewError("reading response body failed").AddError(err)
+	}
+	log.Trace().Str("body", string(data)).Msg("HTTP response")
+	if resp.StatusCode != http.StatusOK {
+		return data, apperror.NewErrorf("HTTP request failed with status %d: %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	return data, nil
+}
+
+// soapField returns the text of the first element with the given local name
+func soapField(body []byte, name string) string {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != name {
+			continue
+		}
+		var value string
+		if err := decoder.DecodeElement(&value, &start); err != nil {
+			return ""
+		}
+		return value
+	}
+}
+
+// digestAuthorization answers an HTTP digest challenge as required by TR-064
+func digestAuthorization(challenge, method, uri, username, password string) string {
+	params := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(challenge, "Digest "), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			params[strings.ToLower(key)] = strings.Trim(value, `"`)
+		}
+	}
+
+	hash := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	nonce := make([]byte, 8)
+	_, _ = rand.Read(nonce)
+	cnonce, nc := hex.EncodeToString(nonce), "00000001"
+
+	ha1 := hash(username + ":" + params["realm"] + ":" + password)
+	ha2 := hash(method + ":" + uri)
+	response := hash(ha1 + ":" + params["nonce"] + ":" + ha2)
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s"`, username, params["realm"], params["nonce"], uri)
+	if params["qop"] != "" {
+		response = hash(ha1 + ":" + params["nonce"] + ":" + nc + ":" + cnonce + ":auth:" + ha2)
+		header += fmt.Sprintf(`, qop=auth, nc=%s, cnonce="%s"`, nc, cnonce)
+	}
+	header += fmt.Sprintf(`, response="%s"`, response)
+	if params["opaque"] != "" {
+		header += fmt.Sprintf(`, opaque="%s"`, params["opaque"])
+	}
+	return header
+}
+
+// discoverGateway finds the device description of an internet gateway device in the local network with SSDP
+func discoverGateway(timeout time.Duration) (string, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return "", apperror.NewError("failed to open SSDP socket").AddError(err)
+	}
+	defer apperror.Catch(conn.Close, "failed to close SSDP socket")
+
+	target, err := net.ResolveUDPAddr("udp4", ssdpAddress)
+	if err != nil {
+		return "", apperror.NewError("failed to resolve SSDP address").AddError(err)
+	}
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddress + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(search), target); err != nil {
+		return "", apperror.NewError("failed to send SSDP search").AddError(err)
+	}
+
+	err = conn.SetDeadline(time.Now().Add(timeout))
+	if err != nil {
+		return "", apperror.NewError("failed to set SSDP deadline").AddError(err)
+	}
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return "", apperror.NewError("no internet gateway device answered the SSDP search").AddError(err)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		if location := resp.Header.Get("Location"); location != "" {
+			log.Debug().Msgf("[DNS] discovered internet gateway device at %s", location)
+			return location, nil
+		}
+	}
+}
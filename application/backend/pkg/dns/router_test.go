@@ -0,0 +1,204 @@
+package dns
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Valentin-Kaiser/hdns/pkg/config"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+)
+
+const (
+	testRouterRealm = "F!Box SOAP-Auth"
+	testRouterNonce = "0123456789ABCDEF"
+)
+
+// testRouter is an in-process SOAP server that describes a gateway with the service and answers its actions
+type testRouter struct {
+	*httptest.Server
+	service  string
+	password string
+	// answers maps an action to its response field and value, missing actions are answered with a fault
+	answers    map[string][2]string
+	challenges atomic.Int32
+}
+
+func newTestRouter(t *testing.T, service, password string, answers map[string][2]string) *testRouter {
+	t.Helper()
+	r := &testRouter{service: service, password: password, answers: answers}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/desc.xml", r.description)
+	mux.HandleFunc("/upnp/control/wan", r.control)
+	r.Server = httptest.NewServer(mux)
+	t.Cleanup(r.Close)
+	return r
+}
+
+// description nests the WAN connection service in an embedded device like real gateways do
+func (r *testRouter) description(w http.ResponseWriter, _ *http.Request) {
+	fmt.Fprintf(w, `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <serviceList>
+      <service><serviceType>urn:schemas-upnp-org:service:Layer3Forwarding:1</serviceType><controlURL>/l3f</controlURL></service>
+    </serviceList>
+    <deviceList>
+      <device>
+        <serviceList>
+          <service><serviceType>%s</serviceType><controlURL>/upnp/control/wan</controlURL></service>
+        </serviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`, r.service)
+}
+
+func (r *testRouter) control(w http.ResponseWriter, req *http.Request) {
+	if r.password != "" && !r.authorized(req) {
+		r.challenges.Add(1)
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", nonce="%s", qop="auth", algorithm=MD5`, testRouterRealm, testRouterNonce))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	action := strings.TrimPrefix(strings.Trim(req.Header.Get("SOAPAction"), `"`), r.service+"#")
+	body, _ := io.ReadAll(req.Body)
+	if !strings.Contains(string(body), "<u:"+action+` xmlns:u="`+r.service+`">`) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	answer, ok := r.answers[action]
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>`+
+			`<s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>`+
+			`<UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>401</errorCode><errorDescription>Invalid Action</errorDescription></UPnPError>`+
+			`</detail></s:Fault></s:Body></s:Envelope>`)
+		return
+	}
+	fmt.Fprintf(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>`+
+		`<u:%sResponse xmlns:u="%s"><%s>%s</%s></u:%sResponse></s:Body></s:Envelope>`,
+		action, r.service, answer[0], answer[1], answer[0], action)
+}
+
+// authorized verifies the digest response the way the router would
+func (r *testRouter) authorized(req *http.Request) bool {
+	header := req.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Digest ") {
+		return false
+	}
+	params := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(header, "Digest "), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			params[key] = strings.Trim(value, `"`)
+		}
+	}
+	hash := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	ha1 := hash(params["username"] + ":" + testRouterRealm + ":" + r.password)
+	ha2 := hash(req.Method + ":" + req.URL.RequestURI())
+	want := hash(ha1 + ":" + testRouterNonce + ":" + params["nc"] + ":" + params["cnonce"] + ":" + params["qop"] + ":" + ha2)
+	return params["nonce"] == testRouterNonce && params["uri"] == req.URL.RequestURI() && params["response"] == want
+}
+
+func TestRouterUPnP(t *testing.T) {
+	router := newTestRouter(t, "urn:schemas-upnp-org:service:WANIPConnection:1", "", map[string][2]string{
+		"GetExternalIPAddress": {"NewExternalIPAddress", "203.0.113.7"},
+	})
+	source, err := NewSource(config.AddressSource{Type: config.SourceUPnP, URL: router.URL + "/desc.xml"})
+	if err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+
+	addr, err := source.Address(model.FamilyIPv4)
+	if err != nil || addr != "203.0.113.7" {
+		t.Fatalf("address = %q, %v, want 203.0.113.7", addr, err)
+	}
+	// The IPv6 action is AVM specific and answered with a fault
+	if _, err := source.Address(model.FamilyIPv6); err == nil {
+		t.Fatal("expected an error for the unsupported IPv6 action")
+	}
+}
+
+func TestRouterTR064Digest(t *testing.T) {
+	router := newTestRouter(t, "urn:dslforum-org:service:WANIPConnection:1", "secret", map[string][2]string{
+		"GetExternalIPAddress":            {"NewExternalIPAddress", "192.168.1.7"},
+		"X_AVM_DE_GetExternalIPv6Address": {"NewExternalIPv6Address", "2001:db8::7"},
+	})
+	source := &routerSource{
+		kind:     config.SourceTR064,
+		location: router.URL + "/desc.xml",
+		username: "hdns",
+		password: "secret",
+		services: []string{"urn:dslforum-org:service:WANIPConnection:"},
+	}
+
+	addr, err := source.Address(model.FamilyIPv6)
+	if err != nil || addr != "2001:db8::7" {
+		t.Fatalf("address = %q, %v, want 2001:db8::7", addr, err)
+	}
+	// The control request is challenged once and answered with the digest
+	if n := router.challenges.Load(); n != 1 {
+		t.Fatalf("router sent %d challenges, want 1", n)
+	}
+
+	wan, err := source.WAN(model.FamilyIPv4)
+	if err != nil || wan != "192.168.1.7" {
+		t.Fatalf("WAN = %q, %v, want 192.168.1.7", wan, err)
+	}
+	if _, err := source.Address(model.FamilyIPv4); err == nil {
+		t.Fatal("a non public WAN address must not be returned as public address")
+	}
+
+	source.password = "wrong"
+	if _, err := source.WAN(model.FamilyIPv4); err == nil {
+		t.Fatal("expected an error for a wrong password")
+	}
+}
+
+func TestRouterFault(t *testing.T) {
+	router := newTestRouter(t, "urn:schemas-upnp-org:service:WANPPPConnection:1", "", nil)
+	source, err := NewSource(config.AddressSource{Type: config.SourceUPnP, URL: router.URL + "/desc.xml"})
+	if err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+	if _, err := source.Address(model.FamilyIPv4); err == nil || !strings.Contains(err.Error(), "Invalid Action") {
+		t.Fatalf("expected the fault description in the error, got %v", err)
+	}
+
+	s := source.(*routerSource)
+	s.services = []string{"urn:schemas-upnp-org:service:WANIPConnection:"}
+	if _, err := s.WAN(model.FamilyIPv4); err == nil || !strings.Contains(err.Error(), "no WAN connection service") {
+		t.Fatalf("expected a missing service error, got %v", err)
+	}
+}
+
+func TestDigestAuthorization(t *testing.T) {
+	// RFC 2617 section 3.5 without qop
+	got := digestAuthorization(`Digest realm="testrealm@host.com", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`,
+		http.MethodGet, "/dir/index.html", "Mufasa", "Circle Of Life")
+	for _, want := range []string{
+		`username="Mufasa"`,
+		`realm="testrealm@host.com"`,
+		`uri="/dir/index.html"`,
+		`response="670fd8c2df070c60b045671b8b24ff02"`,
+		`opaque="5ccc069c403ebaf9f0171e9517f40e41"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("%s is missing %s", got, want)
+		}
+	}
+	if strings.Contains(got, "qop=") {
+		t.Fatalf("%s answers qop that was not offered", got)
+	}
+}
@@ -1,6 +1,8 @@
 package dns
 
 import (
+	"sync"
+
 	"github.com/Valentin-Kaiser/go-core/database"
 	"github.com/Valentin-Kaiser/hdns/pkg/config"
 	"github.com/Valentin-Kaiser/hdns/pkg/model"
@@ -9,9 +11,14 @@ import (
 	"gorm.io/gorm"
 )
 
-var job *cron.Cron
+var (
+	job *cron.Cron
+	// refreshMutex serializes refreshes started by the cron job and by address change events
+	refreshMutex = &sync.Mutex{}
+)
 
 func Start() {
+	startWatch()
 	job = cron.New(cron.WithSeconds())
 	_, err := job.AddFunc(config.Get().Service.Refresh, Refresh)
 	if err != nil {
@@ -22,6 +29,10 @@ func Start() {
 }
 
 func Stop() {
+	stopWatch()
+	if job == nil {
+		return
+	}
 	ctx := job.Stop()
 	<-ctx.Done()
 }
@@ -32,50 +43,72 @@ func Restart() {
 	log.Info().Msg("[DNS] refresh cron job restarted")
 }
 
+// Refresh detects the public addresses of every uplink and publishes them to all records that are out of date
 func Refresh() {
-	_, err := UpdateAddress()
-	if err != nil {
-		log.Error().Err(err).Msg("failed to update public IP address")
-		return
-	}
+	refreshMutex.Lock()
+	defer refreshMutex.Unlock()
+
 	var records []*model.Record
-	err = database.Execute(func(db *gorm.DB) error {
-		return db.Find(&records).Error
+	err := database.Execute(func(db *gorm.DB) error {
+		return db.Preload("Targets").Find(&records).Error
 	})
 	if err != nil {
 		log.Error().Err(err).Msg("failed to fetch DNS records")
 		return
 	}
-	for _, record := range records {
-		err := RefreshRecord(record)
-		if err != nil {
-			log.Error().Err(err).Msgf("failed to refresh DNS record %s.%s", record.Name, record.Domain)
-		}
+
+	uplinks := map[string][]*model.Record{}
+	for _, r := range records {
+		uplinks[r.Uplink] = append(uplinks[r.Uplink], r)
+	}
+	for _, name := range uplinkNames(records) {
+		refreshUplink(name, uplinks[name])
 	}
 }
 
-func RefreshRecord(record *model.Record) error {
-	var current *model.Address
-	err := database.Execute(func(db *gorm.DB) error {
-		return db.Where("current = ?", true).First(&current).Error
-	})
+// refreshUplink detects the public addresses of the uplink and publishes them to its records
+func refreshUplink(name string, records []*model.Record) {
+	current, err := UpdateAddresses(name, Families(records)...)
 	if err != nil {
-		return err
+		log.Error().Err(err).Msg("failed to update public IP address")
+		// Records following another hostname do not depend on the detected address
+		publishMany(following(records), Addresses{})
+		return
 	}
+	publishMany(records, current)
+}
 
-	rec, found, err := FetchRecord(record)
+// RefreshRecord publishes the current addresses of its uplink to every target of the record that is out of date
+func RefreshRecord(record *model.Record) error {
+	current, err := CurrentAddresses(record.Uplink)
 	if err != nil {
 		return err
 	}
 
-	if found && rec.Value == current.IP {
-		log.Info().Msgf("[DNS] record %s.%s is already up-to-date with address %s", record.Name, record.Domain, current.IP)
-		return nil
+	return publishAll(record, current, false)
+}
+
+// following returns the records that copy the addresses of another hostname
+func following(records []*model.Record) []*model.Record {
+	followers := []*model.Record{}
+	for _, r := range records {
+		if r.Follow != "" {
+			followers = append(followers, r)
+		}
 	}
+	return followers
+}
 
-	err = UpdateRecord(record, current)
-	if err != nil {
-		return err
+// Families returns the address families the records publish
+// IPv4 is always detected so the current address of every uplink stays known without any records
+func Families(records []*model.Record) []string {
+	families := []string{model.FamilyIPv4}
+	for _, r := range records {
+		for _, recordType := range r.Types() {
+			if model.FamilyOf(recordType) == model.FamilyIPv6 {
+				return append(families, model.FamilyIPv6)
+			}
+		}
 	}
-	return nil
+	return families
 }
@@ -0,0 +1,71 @@
+package dns
+
+import (
+	"sync"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/hdns/pkg/config"
+)
+
+var (
+	sourceMutex = &sync.RWMutex{}
+	sources     = make(map[string]SourceFactory)
+)
+
+// Source detects the public address of the host
+type Source interface {
+	// String describes the source in logs
+	String() string
+	// Address returns the public address of the given family
+	Address(family string) (string, error)
+}
+
+// SplitSource is implemented by sources that ask several independent services
+// In consensus mode every service gets its own vote instead of the source answering with the first success
+type SplitSource interface {
+	Source
+	// Split returns a source for every service
+	Split() []Source
+}
+
+// SourceFactory creates an address source from its configuration
+type SourceFactory func(c config.AddressSource) (Source, error)
+
+// RegisterSource makes an address source available under the given type
+func RegisterSource(kind string, factory SourceFactory) {
+	if kind == "" {
+		panic("source type cannot be empty")
+	}
+	if factory == nil {
+		panic("source factory cannot be nil")
+	}
+
+	sourceMutex.Lock()
+	defer sourceMutex.Unlock()
+	sources[kind] = factory
+}
+
+// NewSource creates the address source described by the configuration
+func NewSource(c config.AddressSource) (Source, error) {
+	sourceMutex.RLock()
+	factory, ok := sources[c.Type]
+	sourceMutex.RUnlock()
+	if !ok {
+		return nil, apperror.NewErrorf("unknown address source %q", c.Type)
+	}
+
+	s, err := factory(c)
+	if err != nil {
+		return nil, apperror.NewErrorf("failed to create address source %s", c.Type).AddError(err)
+	}
+	return s, nil
+}
+
+// configuredSources returns the configured address sources, the HTTP resolvers if none are configured
+func configuredSources() []config.AddressSource {
+	configured := config.Get().Service.Sources
+	if len(configured) == 0 {
+		return []config.AddressSource{{Type: config.SourceHTTP}}
+	}
+	return configured
+}
@@ -0,0 +1,214 @@
+package dns
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/hdns/pkg/config"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	stunMagicCookie     = 0x2112A442
+	stunBindingRequest  = 0x0001
+	stunBindingResponse = 0x0101
+	stunMappedAddress   = 0x0001
+	stunXORMappedAddr   = 0x0020
+	stunHeaderLength    = 20
+	stunAttempts        = 3
+)
+
+var (
+	stunServers = []string{
+		"stun.l.google.com:19302",
+		"stun.cloudflare.com:3478",
+		"stun.nextcloud.com:443",
+	}
+	stunTimeout = 2 * time.Second
+)
+
+func init() {
+	RegisterSource(config.SourceSTUN, func(c config.AddressSource) (Source, error) {
+		servers := c.Servers
+		if len(servers) == 0 {
+			servers = stunServers
+		}
+		return &stunSource{servers: servers}, nil
+	})
+}
+
+// stunSource learns the public address from the XOR-MAPPED-ADDRESS of a STUN binding response (RFC 5389)
+type stunSource struct {
+	servers []string
+	link    *uplink
+}
+
+func (s *stunSource) String() string {
+	return "stun " + strings.Join(s.servers, ", ")
+}
+
+func (s *stunSource) bind(link *uplink) Source {
+	return &stunSource{servers: s.servers, link: link}
+}
+
+func (s *stunSource) Address(family string) (string, error) {
+	network := "udp4"
+	if family == model.FamilyIPv6 {
+		network = "udp6"
+	}
+	for _, server := range s.servers {
+		addr, err := stunBinding(s.link, network, server)
+		if err != nil {
+			log.Error().Err(err).Msgf("STUN server %s failed", server)
+			continue
+		}
+		if !ValidateAddress(addr) || Family(addr) != family {
+			log.Error().Msgf("STUN server %s answered with the invalid %s address %s", server, family, addr)
+			continue
+		}
+		return addr, nil
+	}
+	return "", apperror.NewErrorf("failed to resolve public %s address using all STUN servers", family)
+}
+
+// Split returns every server as its own source so each one gets a vote
+func (s *stunSource) Split() []Source {
+	split := make([]Source, 0, len(s.servers))
+	for _, server := range s.servers {
+		split = append(split, &stunSource{servers: []string{server}, link: s.link})
+	}
+	return split
+}
+
+// stunBinding sends a binding request to the server through the uplink and returns the mapped address
+// UDP is unreliable so the request is retransmitted a few times
+func stunBinding(link *uplink, network, server string) (string, error) {
+	conn, err := link.dialer(network, stunTimeout).Dial(network, server)
+	if err != nil {
+		return "", apperror.NewErrorf("failed to connect to STUN server %s", server).AddError(err)
+	}
+	defer apperror.Catch(conn.Close, "failed to close STUN connection")
+
+	request, transaction, err := stunRequest()
+	if err != nil {
+		return "", apperror.Wrap(err)
+	}
+
+	buf := make([]byte, 1500)
+	for attempt := 0; attempt < stunAttempts; attempt++ {
+		if _, err := conn.Write(request); err != nil {
+			return "", apperror.NewErrorf("failed to send STUN request to %s", server).AddError(err)
+		}
+		if err := conn.SetReadDeadline(time.Now().Add(stunTimeout)); err != nil {
+			return "", apperror.NewError("failed to set STUN deadline").AddError(err)
+		}
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				break
+			}
+			addr, ok, err := parseStunResponse(buf[:n], transaction)
+			if err != nil {
+				return "", apperror.NewErrorf("invalid STUN response from %s", server).AddError(err)
+			}
+			if ok {
+				return addr, nil
+			}
+		}
+	}
+	return "", apperror.NewErrorf("STUN server %s did not answer", server)
+}
+
+// stunRequest builds a binding request without attributes
+func stunRequest() ([]byte, []byte, error) {
+	msg := make([]byte, stunHeaderLength)
+	binary.BigEndian.PutUint16(msg[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint16(msg[2:4], 0)
+	binary.BigEndian.PutUint32(msg[4:8], stunMagicCookie)
+	if _, err := rand.Read(msg[8:20]); err != nil {
+		return nil, nil, apperror.NewError("failed to create STUN transaction ID").AddError(err)
+	}
+	return msg, msg[8:20], nil
+}
+
+// parseStunResponse reads the mapped address of a binding response
+// Messages of other transactions are ignored by returning false
+func parseStunResponse(msg, transaction []byte) (string, bool, error) {
+	if len(msg) < stunHeaderLength || binary.BigEndian.Uint32(msg[4:8]) != stunMagicCookie {
+		return "", false, apperror.NewError("message is not a STUN message")
+	}
+	if !bytes.Equal(msg[8:20], transaction) {
+		return "", false, nil
+	}
+	if binary.BigEndian.Uint16(msg[0:2]) != stunBindingResponse {
+		return "", false, apperror.NewErrorf("unexpected STUN message type 0x%04x", binary.BigEndian.Uint16(msg[0:2]))
+	}
+
+	length := int(binary.BigEndian.Uint16(msg[2:4]))
+	if len(msg) < stunHeaderLength+length {
+		return "", false, apperror.NewError("STUN message is truncated")
+	}
+	attrs := msg[stunHeaderLength : stunHeaderLength+length]
+
+	mapped := ""
+	for len(attrs) >= 4 {
+		kind := binary.BigEndian.Uint16(attrs[0:2])
+		size := int(binary.BigEndian.Uint16(attrs[2:4]))
+		if len(attrs) < 4+size {
+			return "", false, apperror.NewError("STUN attribute is truncated")
+		}
+		value := attrs[4 : 4+size]
+		switch kind {
+		case stunXORMappedAddr:
+			ip, err := stunAddress(value, msg[4:20])
+			if err != nil {
+				return "", false, apperror.Wrap(err)
+			}
+			return ip.String(), true, nil
+		case stunMappedAddress:
+			ip, err := stunAddress(value, nil)
+			if err != nil {
+				return "", false, apperror.Wrap(err)
+			}
+			mapped = ip.String()
+		}
+		// Attributes are padded to a multiple of four bytes
+		attrs = attrs[min(4+(size+3)&^3, len(attrs)):]
+	}
+	if mapped == "" {
+		return "", false, apperror.NewError("STUN response has no mapped address")
+	}
+	return mapped, true, nil
+}
+
+// stunAddress decodes a (XOR-)MAPPED-ADDRESS value, the key is the magic cookie and transaction ID for XOR addresses
+func stunAddress(value, key []byte) (net.IP, error) {
+	if len(value) < 4 {
+		return nil, apperror.NewError("STUN address is truncated")
+	}
+	var ip net.IP
+	switch value[1] {
+	case 0x01:
+		ip = make(net.IP, net.IPv4len)
+	case 0x02:
+		ip = make(net.IP, net.IPv6len)
+	default:
+		return nil, apperror.NewErrorf("unknown STUN address family 0x%02x", value[1])
+	}
+	if len(value) < 4+len(ip) {
+		return nil, apperror.NewError("STUN address is truncated")
+	}
+	copy(ip, value[4:4+len(ip)])
+	if key != nil {
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+	return ip, nil
+}
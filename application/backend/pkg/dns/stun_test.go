@@ -0,0 +1,176 @@
+package dns
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+var testTransaction = []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+
+// stunMessage builds a STUN message of the given type and transaction with the attributes
+func stunMessage(kind uint16, transaction []byte, attrs ...[]byte) []byte {
+	body := []byte{}
+	for _, attr := range attrs {
+		body = append(body, attr...)
+	}
+	msg := make([]byte, stunHeaderLength)
+	binary.BigEndian.PutUint16(msg[0:2], kind)
+	binary.BigEndian.PutUint16(msg[2:4], uint16(len(body)))
+	binary.BigEndian.PutUint32(msg[4:8], stunMagicCookie)
+	copy(msg[8:20], transaction)
+	return append(msg, body...)
+}
+
+// stunAttribute encodes an attribute padded to a multiple of four bytes
+func stunAttribute(kind uint16, value []byte) []byte {
+	attr := make([]byte, 4, 4+len(value)+3)
+	binary.BigEndian.PutUint16(attr[0:2], kind)
+	binary.BigEndian.PutUint16(attr[2:4], uint16(len(value)))
+	attr = append(attr, value...)
+	for len(attr)%4 != 0 {
+		attr = append(attr, 0)
+	}
+	return attr
+}
+
+// stunAddressValue encodes an address, XORed with the magic cookie and transaction if xor is set
+func stunAddressValue(ip net.IP, port int, transaction []byte, xor bool) []byte {
+	family, addr := byte(0x01), ip.To4()
+	if addr == nil {
+		family, addr = 0x02, ip.To16()
+	}
+	value := []byte{0, family, 0, 0}
+	binary.BigEndian.PutUint16(value[2:4], uint16(port))
+	addr = append(net.IP{}, addr...)
+	if xor {
+		key := binary.BigEndian.AppendUint32(nil, stunMagicCookie)
+		key = append(key, transaction...)
+		binary.BigEndian.PutUint16(value[2:4], uint16(port)^uint16(stunMagicCookie>>16))
+		for i := range addr {
+			addr[i] ^= key[i]
+		}
+	}
+	return append(value, addr...)
+}
+
+func TestParseStunResponse(t *testing.T) {
+	v4 := net.ParseIP("203.0.113.7")
+	v6 := net.ParseIP("2001:db8::7")
+	tests := []struct {
+		name    string
+		msg     []byte
+		want    string
+		ok      bool
+		wantErr bool
+	}{
+		{
+			name: "xor mapped ipv4",
+			msg:  stunMessage(stunBindingResponse, testTransaction, stunAttribute(stunXORMappedAddr, stunAddressValue(v4, 4242, testTransaction, true))),
+			want: "203.0.113.7",
+			ok:   true,
+		},
+		{
+			name: "xor mapped ipv6",
+			msg:  stunMessage(stunBindingResponse, testTransaction, stunAttribute(stunXORMappedAddr, stunAddressValue(v6, 4242, testTransaction, true))),
+			want: "2001:db8::7",
+			ok:   true,
+		},
+		{
+			name: "xor mapped wins over mapped after a padded attribute",
+			msg: stunMessage(stunBindingResponse, testTransaction,
+				stunAttribute(0x8022, []byte("hdns")[:3]),
+				stunAttribute(stunMappedAddress, stunAddressValue(net.ParseIP("198.51.100.1"), 4242, nil, false)),
+				stunAttribute(stunXORMappedAddr, stunAddressValue(v4, 4242, testTransaction, true))),
+			want: "203.0.113.7",
+			ok:   true,
+		},
+		{
+			name: "mapped address fallback",
+			msg:  stunMessage(stunBindingResponse, testTransaction, stunAttribute(stunMappedAddress, stunAddressValue(v4, 4242, nil, false))),
+			want: "203.0.113.7",
+			ok:   true,
+		},
+		{
+			name: "foreign transaction",
+			msg:  stunMessage(stunBindingResponse, []byte("otherrequest"), stunAttribute(stunXORMappedAddr, stunAddressValue(v4, 4242, []byte("otherrequest"), true))),
+		},
+		{
+			name:    "truncated attribute",
+			msg:     stunMessage(stunBindingResponse, testTransaction, stunAttribute(stunXORMappedAddr, stunAddressValue(v4, 4242, testTransaction, true))[:8]),
+			wantErr: true,
+		},
+		{
+			name:    "truncated address",
+			msg:     stunMessage(stunBindingResponse, testTransaction, stunAttribute(stunXORMappedAddr, stunAddressValue(v6, 4242, testTransaction, true)[:12])),
+			wantErr: true,
+		},
+		{
+			name:    "truncated message",
+			msg:     stunMessage(stunBindingResponse, testTransaction, stunAttribute(stunXORMappedAddr, stunAddressValue(v4, 4242, testTransaction, true)))[:24],
+			wantErr: true,
+		},
+		{
+			name:    "error response",
+			msg:     stunMessage(0x0111, testTransaction, stunAttribute(0x0009, []byte{0, 0, 4, 0})),
+			wantErr: true,
+		},
+		{
+			name:    "no mapped address",
+			msg:     stunMessage(stunBindingResponse, testTransaction),
+			wantErr: true,
+		},
+		{
+			name:    "not a stun message",
+			msg:     []byte("hello"),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := parseStunResponse(tt.msg, testTransaction)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if ok != tt.ok || got != tt.want {
+				t.Fatalf("got %q %v, want %q %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+// TestStunBinding runs a binding request against an in-process responder that first answers a foreign transaction
+func TestStunBinding(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < stunHeaderLength {
+				continue
+			}
+			transaction := append([]byte{}, buf[8:20]...)
+			client := from.(*net.UDPAddr)
+			_, _ = conn.WriteTo(stunMessage(stunBindingResponse, []byte("otherrequest")), from)
+			_, _ = conn.WriteTo(stunMessage(stunBindingResponse, transaction,
+				stunAttribute(stunXORMappedAddr, stunAddressValue(client.IP, client.Port, transaction, true))), from)
+		}
+	}()
+
+	addr, err := stunBinding(nil, "udp4", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("binding failed: %v", err)
+	}
+	if addr != "127.0.0.1" {
+		t.Fatalf("mapped address is %s, want 127.0.0.1", addr)
+	}
+}
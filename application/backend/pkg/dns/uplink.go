@@ -0,0 +1,145 @@
+package dns
+
+import (
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/hdns/pkg/config"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+// uplink is a WAN connection with its own address sources and current addresses
+// The default uplink has no name and sends its probes along the routing table of the host
+type uplink struct {
+	name    string
+	iface   string
+	locals  []string
+	sources []config.AddressSource
+}
+
+// boundSource is implemented by sources whose probes can be sent through a specific uplink
+type boundSource interface {
+	Source
+	// bind returns the source sending its probes through the uplink
+	bind(link *uplink) Source
+}
+
+// findUplink returns the configured uplink with the given name, the default one for an empty name
+func findUplink(name string) (*uplink, error) {
+	if name == "" {
+		return &uplink{sources: configuredSources()}, nil
+	}
+	u, ok := config.Get().Service.Uplink(name)
+	if !ok {
+		return nil, apperror.NewErrorf("unknown uplink %q", name)
+	}
+	sources := u.Sources
+	if len(sources) == 0 {
+		sources = []config.AddressSource{{Type: config.SourceHTTP}}
+	}
+	return &uplink{name: u.Name, iface: u.Interface, locals: u.LocalAddresses, sources: sources}, nil
+}
+
+// uplinkNames returns the default and all configured uplinks followed by the unknown ones records refer to
+func uplinkNames(records []*model.Record) []string {
+	names := []string{""}
+	for _, u := range config.Get().Service.Uplinks {
+		names = append(names, u.Name)
+	}
+	for _, r := range records {
+		if !slices.Contains(names, r.Uplink) {
+			names = append(names, r.Uplink)
+		}
+	}
+	return names
+}
+
+func (u *uplink) String() string {
+	if u == nil || u.name == "" {
+		return "default uplink"
+	}
+	return "uplink " + u.name
+}
+
+// bound reports whether the probes of the uplink are bound to an interface or local address
+func (u *uplink) bound() bool {
+	return u != nil && (u.iface != "" || len(u.locals) > 0)
+}
+
+// newSource creates an address source whose probes leave through the uplink
+func (u *uplink) newSource(c config.AddressSource) (Source, error) {
+	source, err := NewSource(c)
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
+	if b, ok := source.(boundSource); ok && u.bound() {
+		return b.bind(u), nil
+	}
+	return source, nil
+}
+
+// healthName keeps the health of a probe per uplink, a service failing on one uplink may work on another
+func (u *uplink) healthName(name string) string {
+	if !u.bound() {
+		return name
+	}
+	return u.name + " " + name
+}
+
+// dialer returns a dialer whose connections over the network, e.g. tcp4 or udp6, leave through the uplink
+func (u *uplink) dialer(network string, timeout time.Duration) *net.Dialer {
+	d := &net.Dialer{Timeout: timeout}
+	if !u.bound() {
+		return d
+	}
+
+	family := ""
+	switch {
+	case strings.HasSuffix(network, "4"):
+		family = model.FamilyIPv4
+	case strings.HasSuffix(network, "6"):
+		family = model.FamilyIPv6
+	}
+	for _, local := range u.locals {
+		if Family(local) != family {
+			continue
+		}
+		ip := net.ParseIP(local)
+		if strings.HasPrefix(network, "udp") {
+			d.LocalAddr = &net.UDPAddr{IP: ip}
+		} else {
+			d.LocalAddr = &net.TCPAddr{IP: ip}
+		}
+		break
+	}
+	if u.iface != "" {
+		err := bindInterface(d, u.iface, network)
+		if err != nil {
+			log.Error().Err(err).Msgf("[DNS] failed to bind the probes of %s to network interface %s", u, u.iface)
+		}
+	}
+	return d
+}
+
+// client returns the HTTP client of the family, bound clients do not keep connections as they are created for every probe
+func (u *uplink) client(family string) (*http.Client, error) {
+	client, ok := clients[family]
+	if !ok {
+		return nil, apperror.NewErrorf("unknown address family %q", family)
+	}
+	if !u.bound() {
+		return client, nil
+	}
+	network := "tcp4"
+	if family == model.FamilyIPv6 {
+		network = "tcp6"
+	}
+	client = newClient(network, u.dialer(network, 10*time.Second))
+	client.Transport.(*http.Transport).DisableKeepAlives = true
+	return client, nil
+}
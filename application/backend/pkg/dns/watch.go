@@ -0,0 +1,112 @@
+package dns
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Valentin-Kaiser/hdns/pkg/config"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	watchMutex  = &sync.Mutex{}
+	watchCancel context.CancelFunc
+	// watchDebounce waits for the burst of events of a reconnect to settle before refreshing
+	watchDebounce = 3 * time.Second
+)
+
+// startWatch refreshes immediately whenever a WAN interface gets a new address or default route
+// The cron job keeps running as a safety net for changes that happen behind the router
+func startWatch() {
+	names := watchedInterfaces()
+	if len(names) == 0 {
+		return
+	}
+
+	watchMutex.Lock()
+	defer watchMutex.Unlock()
+	if watchCancel != nil {
+		watchCancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	watchCancel = cancel
+
+	events := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case events <- struct{}{}:
+		default:
+		}
+	}
+	go func() {
+		err := subscribe(ctx, names, notify)
+		if err != nil {
+			log.Error().Err(err).Msgf("[DNS] failed to watch network interfaces %s for address changes", strings.Join(names, ", "))
+		}
+	}()
+	go debounce(ctx, events, watchDebounce, func() {
+		log.Info().Msgf("[DNS] a watched network interface changed its address, refreshing")
+		Refresh()
+	})
+	log.Info().Msgf("[DNS] watching network interfaces %s for address changes", strings.Join(names, ", "))
+}
+
+func stopWatch() {
+	watchMutex.Lock()
+	defer watchMutex.Unlock()
+	if watchCancel != nil {
+		watchCancel()
+		watchCancel = nil
+	}
+}
+
+// watchedInterfaces returns the configured WAN interface, the one of the first interface source if none is configured,
+// and the interfaces of the uplinks, those they are bound to or read their address from
+func watchedInterfaces() []string {
+	names := []string{}
+	add := func(name string) {
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	service := config.Get().Service
+	if service.Watch != "" {
+		add(service.Watch)
+	} else {
+		for _, c := range configuredSources() {
+			if c.Type == config.SourceInterface {
+				add(c.Interface)
+				break
+			}
+		}
+	}
+	for _, u := range service.Uplinks {
+		add(u.Interface)
+		for _, c := range u.Sources {
+			if c.Type == config.SourceInterface {
+				add(c.Interface)
+			}
+		}
+	}
+	return names
+}
+
+// debounce calls f once no event arrived for the given wait time
+func debounce(ctx context.Context, events <-chan struct{}, wait time.Duration, f func()) {
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-events:
+			timer = time.After(wait)
+		case <-timer:
+			timer = nil
+			f()
+		}
+	}
+}
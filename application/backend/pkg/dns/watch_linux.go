@@ -0,0 +1,97 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"slices"
+	"syscall"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+)
+
+// Multicast groups of address and route changes, missing in the syscall package
+const (
+	rtmgrpIPv4Ifaddr = 0x10
+	rtmgrpIPv4Route  = 0x40
+	rtmgrpIPv6Ifaddr = 0x100
+	rtmgrpIPv6Route  = 0x400
+)
+
+// subscribe listens to netlink address and route events and notifies about new global addresses and default routes of the interfaces
+// The interfaces are matched by name as a reconnecting PPP interface is created with a new index
+func subscribe(ctx context.Context, names []string, notify func()) error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return apperror.NewError("failed to open netlink socket").AddError(err)
+	}
+	defer apperror.Catch(func() error { return syscall.Close(fd) }, "failed to close netlink socket")
+
+	groups := uint32(rtmgrpIPv4Ifaddr | rtmgrpIPv4Route | rtmgrpIPv6Ifaddr | rtmgrpIPv6Route)
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: groups})
+	if err != nil {
+		return apperror.NewError("failed to subscribe to netlink events").AddError(err)
+	}
+	// A receive timeout lets the loop notice the cancelled context
+	err = syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &syscall.Timeval{Sec: 1})
+	if err != nil {
+		return apperror.NewError("failed to set netlink receive timeout").AddError(err)
+	}
+
+	buf := make([]byte, 1<<16)
+	for ctx.Err() == nil {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return apperror.NewError("failed to read netlink events").AddError(err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, m := range msgs {
+			if index, ok := changedInterface(m); ok && slices.Contains(names, interfaceName(index)) {
+				notify()
+			}
+		}
+	}
+	return nil
+}
+
+// changedInterface returns the interface index of a new global address or a new default route
+func changedInterface(m syscall.NetlinkMessage) (uint32, bool) {
+	switch m.Header.Type {
+	case syscall.RTM_NEWADDR:
+		// struct ifaddrmsg: family, prefixlen, flags, scope, index
+		if len(m.Data) < syscall.SizeofIfAddrmsg || m.Data[3] != syscall.RT_SCOPE_UNIVERSE {
+			return 0, false
+		}
+		return binary.NativeEndian.Uint32(m.Data[4:8]), true
+	case syscall.RTM_NEWROUTE:
+		// struct rtmsg: family, dst_len, ... a default route has no destination
+		if len(m.Data) < syscall.SizeofRtMsg || m.Data[1] != 0 {
+			return 0, false
+		}
+		attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+		if err != nil {
+			return 0, false
+		}
+		for _, attr := range attrs {
+			if attr.Attr.Type == syscall.RTA_OIF && len(attr.Value) >= 4 {
+				return binary.NativeEndian.Uint32(attr.Value), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func interfaceName(index uint32) string {
+	iface, err := net.InterfaceByIndex(int(index))
+	if err != nil {
+		return ""
+	}
+	return iface.Name
+}
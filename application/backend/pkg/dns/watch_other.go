@@ -0,0 +1,15 @@
+//go:build !linux
+
+package dns
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+)
+
+// subscribe is only supported on Linux, other systems rely on the cron job
+func subscribe(_ context.Context, names []string, _ func()) error {
+	return apperror.NewErrorf("watching network interfaces %s is only supported on Linux", strings.Join(names, ", "))
+}
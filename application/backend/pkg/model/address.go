@@ -1,7 +1,40 @@
 package model
 
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+const (
+	// NATNone means the router or interface holds the public address itself
+	NATNone = "none"
+	// NATCGNAT means the WAN address is in the shared address space of a carrier-grade NAT
+	NATCGNAT = "cgnat"
+	// NATDouble means the WAN address differs from the public address, another NAT sits in between
+	NATDouble = "double_nat"
+)
+
 type Address struct {
 	BaseModel
 	IP      string `gorm:"not null" json:"ip"`
+	Family  string `gorm:"not null;default:ipv4" json:"family"`
 	Current bool   `gorm:"default:false" json:"current"`
+	// Uplink is the WAN connection the address was detected on, empty for the default one
+	Uplink string `gorm:"not null;default:''" json:"uplink"`
+	// NAT is empty as long as no router or interface source reported a WAN address to compare with
+	NAT string `json:"nat"`
+	WAN string `json:"wan"`
+}
+
+// Reachable reports whether inbound connections to the address can reach the host
+func (a Address) Reachable() bool {
+	return a.NAT != NATCGNAT && a.NAT != NATDouble
+}
+
+// FamilyOf returns the address family published by a DNS record type
+func FamilyOf(recordType string) string {
+	if recordType == RecordTypeAAAA {
+		return FamilyIPv6
+	}
+	return FamilyIPv4
 }
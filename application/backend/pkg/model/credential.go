@@ -0,0 +1,24 @@
+package model
+
+import (
+	"strings"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+)
+
+// Credential describes which DNS provider a record lives on and how to authenticate against it
+type Credential struct {
+	Provider string `gorm:"not null;default:hetzner" json:"provider"`
+	Endpoint string `json:"endpoint"`
+	Token    Token  `gorm:"not null" json:"token"`
+}
+
+func (c *Credential) Validate() error {
+	if strings.TrimSpace(c.Provider) == "" {
+		return apperror.NewError("provider is required")
+	}
+	if strings.TrimSpace(c.Token.String()) == "" {
+		return apperror.NewError("token is required")
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+const (
+	// HealthResolver tracks an HTTP IP echo service, separately per address family
+	HealthResolver = "resolver"
+	// HealthDNS tracks a DNS server used for lookups
+	HealthDNS = "dns"
+)
+
+// Health tracks how reliably an address resolver or DNS server answers
+type Health struct {
+	BaseModel
+	Kind                string     `gorm:"not null;uniqueIndex:idx_health" json:"kind"`
+	Family              string     `gorm:"not null;default:'';uniqueIndex:idx_health" json:"family"`
+	Name                string     `gorm:"not null;uniqueIndex:idx_health" json:"name"`
+	Successes           int        `gorm:"default:0" json:"successes"`
+	Failures            int        `gorm:"default:0" json:"failures"`
+	ConsecutiveFailures int        `gorm:"default:0" json:"consecutive_failures"`
+	Reliability         float64    `json:"reliability"`
+	Latency             int64      `gorm:"default:0" json:"latency"`
+	LastError           string     `json:"last_error"`
+	LastSuccess         *time.Time `json:"last_success"`
+	LastFailure         *time.Time `json:"last_failure"`
+	SkipUntil           *time.Time `json:"skip_until"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/go-core/database"
+	"gorm.io/gorm"
+)
+
+// legacyIndexes are indexes of earlier versions which AutoMigrate keeps as it never drops indexes
+var legacyIndexes = []struct {
+	model any
+	name  string
+}{
+	// Records used to be unique per API token, several records of one account share it now
+	{&Record{}, "idx_records_token"},
+}
+
+// DropLegacyIndexes removes the indexes of earlier versions from an existing database
+func DropLegacyIndexes() error {
+	return database.Execute(func(db *gorm.DB) error {
+		for _, index := range legacyIndexes {
+			if !db.Migrator().HasIndex(index.model, index.name) {
+				continue
+			}
+			err := db.Migrator().DropIndex(index.model, index.name)
+			if err != nil {
+				return apperror.NewErrorf("failed to drop the legacy index %s", index.name).AddError(err)
+			}
+		}
+		return nil
+	})
+}
@@ -10,6 +10,8 @@ func init() {
 	database.RegisterSchema(
 		&Address{},
 		&Record{},
+		&Target{},
+		&Health{},
 	)
 }
 
@@ -5,6 +5,7 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"net"
 	"path/filepath"
 	"strings"
 	"time"
@@ -14,23 +15,43 @@ import (
 	"github.com/Valentin-Kaiser/go-core/security"
 )
 
+const (
+	RecordTypeA    = "A"
+	RecordTypeAAAA = "AAAA"
+	// RecordTypeBoth keeps an A and an AAAA record in sync
+	RecordTypeBoth = "both"
+)
+
 type Record struct {
 	BaseModel
-	Token      Token     `gorm:"uniqueIndex;not null" json:"token"`
-	ZoneID     string    `gorm:"not null" json:"zone_id"`
-	Domain     string    `gorm:"not null" json:"domain"`
-	Name       string    `gorm:"not null" json:"name"`
-	TTL        uint32    `gorm:"not null" json:"ttl"`
-	AddressID  *uint64   `json:"address_id,omitempty"`
-	Address    *Address  `gorm:"foreignKey:AddressID" json:"address,omitempty"`
-	LastUpdate time.Time `gorm:"not null" json:"last_update"`
+	Credential         `gorm:"embedded"`
+	ZoneID             string    `gorm:"not null" json:"zone_id"`
+	Domain             string    `gorm:"not null" json:"domain"`
+	Name               string    `gorm:"not null" json:"name"`
+	TTL                uint32    `gorm:"not null" json:"ttl"`
+	Proxied            bool      `gorm:"default:false" json:"proxied"`
+	Type               string    `gorm:"not null;default:A" json:"type"`
+	IPv6Prefix         uint8     `gorm:"default:0" json:"ipv6_prefix"`
+	IPv6Suffix         string    `json:"ipv6_suffix"`
+	Follow             string    `json:"follow"`
+	Uplink             string    `gorm:"not null;default:''" json:"uplink"`
+	ProviderRecordID   string    `json:"provider_record_id"`
+	ProviderRecordIDV6 string    `json:"provider_record_id_v6"`
+	AddressID          *uint64   `json:"address_id,omitempty"`
+	Address            *Address  `gorm:"foreignKey:AddressID" json:"address,omitempty"`
+	AddressV6ID        *uint64   `json:"address_v6_id,omitempty"`
+	AddressV6          *Address  `gorm:"foreignKey:AddressV6ID" json:"address_v6,omitempty"`
+	LastUpdate         time.Time `gorm:"not null" json:"last_update"`
+	Status             string    `json:"status"`
+	Error              string    `json:"error"`
+	Targets            []Target  `gorm:"foreignKey:RecordID" json:"targets"`
 }
 
 type Token string
 
 func (r *Record) Validate() error {
-	if strings.TrimSpace(r.Token.String()) == "" {
-		return apperror.NewError("token is required")
+	if err := r.Credential.Validate(); err != nil {
+		return apperror.Wrap(err)
 	}
 	if strings.TrimSpace(r.ZoneID) == "" {
 		return apperror.NewError("zone_id is required")
@@ -41,9 +62,56 @@ func (r *Record) Validate() error {
 	if strings.TrimSpace(r.Name) == "" {
 		return apperror.NewError("name is required")
 	}
+	switch r.Type {
+	case "", RecordTypeA, RecordTypeAAAA, RecordTypeBoth:
+	default:
+		return apperror.NewErrorf("type must be %s, %s or %s", RecordTypeA, RecordTypeAAAA, RecordTypeBoth)
+	}
+	if err := r.validateIPv6Suffix(); err != nil {
+		return apperror.Wrap(err)
+	}
+	for i := range r.Targets {
+		if err := r.Targets[i].Validate(); err != nil {
+			return apperror.NewErrorf("target %d is invalid", i+1).AddError(err)
+		}
+	}
 	return nil
 }
 
+// validateIPv6Suffix ensures a host suffix is either an IPv6 interface ID or a MAC address combined with a prefix length
+func (r *Record) validateIPv6Suffix() error {
+	if r.IPv6Suffix == "" {
+		if r.IPv6Prefix != 0 {
+			return apperror.NewError("ipv6_suffix is required when ipv6_prefix is set")
+		}
+		return nil
+	}
+	if r.Type != RecordTypeAAAA && r.Type != RecordTypeBoth {
+		return apperror.NewError("ipv6_suffix requires an AAAA record")
+	}
+	if r.IPv6Prefix == 0 || r.IPv6Prefix > 64 {
+		return apperror.NewError("ipv6_prefix must be between 1 and 64")
+	}
+	if _, err := net.ParseMAC(r.IPv6Suffix); err == nil {
+		return nil
+	}
+	if ip := net.ParseIP(r.IPv6Suffix); ip == nil || ip.To4() != nil {
+		return apperror.NewError("ipv6_suffix must be an IPv6 interface ID like ::1234 or a MAC address")
+	}
+	return nil
+}
+
+// Types returns the DNS record types that are published for the record
+func (r *Record) Types() []string {
+	switch r.Type {
+	case RecordTypeAAAA:
+		return []string{RecordTypeAAAA}
+	case RecordTypeBoth:
+		return []string{RecordTypeA, RecordTypeAAAA}
+	}
+	return []string{RecordTypeA}
+}
+
 func (t Token) MarshalJSON() ([]byte, error) {
 	return []byte(`"` + string(t) + `"`), nil
 }
@@ -110,3 +178,23 @@ func (t *Token) Scan(value interface{}) error {
 func (t Token) String() string {
 	return string(t)
 }
+
+// ValidateFollow checks the hostname the record copies its addresses from
+// It compares the hostname with the record itself, so the domain has to be validated first
+func (r *Record) ValidateFollow() error {
+	if r.Follow == "" {
+		return nil
+	}
+	host := strings.TrimSuffix(r.Follow, ".")
+	if len(host) > 253 || !strings.Contains(host, ".") || strings.ContainsAny(host, " /:@") {
+		return apperror.NewErrorf("follow must be a hostname like router.example.net, got %q", r.Follow)
+	}
+	own := r.Domain
+	if r.Name != "@" {
+		own = r.Name + "." + r.Domain
+	}
+	if strings.EqualFold(host, own) {
+		return apperror.NewError("a record cannot follow itself")
+	}
+	return nil
+}
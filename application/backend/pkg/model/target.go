@@ -0,0 +1,44 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+)
+
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Target is an additional provider a record is mirrored to on every refresh
+type Target struct {
+	BaseModel
+	RecordID           uint64 `gorm:"not null;index" json:"record_id"`
+	Credential         `gorm:"embedded"`
+	ZoneID             string    `gorm:"not null" json:"zone_id"`
+	Domain             string    `gorm:"not null" json:"domain"`
+	ProviderRecordID   string    `json:"provider_record_id"`
+	ProviderRecordIDV6 string    `json:"provider_record_id_v6"`
+	Status             string    `json:"status"`
+	Error              string    `json:"error"`
+	AddressID          *uint64   `json:"address_id,omitempty"`
+	Address            *Address  `gorm:"foreignKey:AddressID" json:"address,omitempty"`
+	AddressV6ID        *uint64   `json:"address_v6_id,omitempty"`
+	AddressV6          *Address  `gorm:"foreignKey:AddressV6ID" json:"address_v6,omitempty"`
+	LastUpdate         time.Time `json:"last_update"`
+}
+
+func (t *Target) Validate() error {
+	if err := t.Credential.Validate(); err != nil {
+		return apperror.Wrap(err)
+	}
+	if strings.TrimSpace(t.ZoneID) == "" {
+		return apperror.NewError("zone_id is required")
+	}
+	if strings.TrimSpace(t.Domain) == "" {
+		return apperror.NewError("domain is required")
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/Valentin-Kaiser/go-core/apperror"
 	"github.com/Valentin-Kaiser/go-core/database"
+	"github.com/Valentin-Kaiser/hdns/pkg/config"
 	"github.com/Valentin-Kaiser/hdns/pkg/dns"
 	"github.com/Valentin-Kaiser/hdns/pkg/model"
 	"gorm.io/gorm"
@@ -36,6 +37,18 @@ func init() {
 			},
 		})
 
+	RegisterEndpoint(
+		EndpointTransportHTTP,
+		EndpointEncodingJSON,
+		[]string{
+			"/api/object/consensus",
+		}, map[string]Handler{
+			"GET": GetConsensus,
+			"OPTIONS": func(context *Context) (interface{}, error) {
+				return nil, nil
+			},
+		})
+
 	RegisterEndpoint(
 		EndpointTransportHTTP,
 		EndpointEncodingJSON,
@@ -75,12 +88,30 @@ func init() {
 	)
 }
 
+// RefreshAddress detects the current addresses of an uplink, the default one unless the uplink query parameter names another
 func RefreshAddress(c *Context) (interface{}, error) {
-	address, err := dns.UpdateAddress()
+	uplink := c.req.URL.Query().Get("uplink")
+	var records []*model.Record
+	err := database.Execute(func(db *gorm.DB) error {
+		return db.Where("uplink = ?", uplink).Find(&records).Error
+	})
+	if err != nil {
+		return nil, apperror.NewError("failed to fetch records").AddError(err)
+	}
+	addresses, err := dns.UpdateAddresses(uplink, dns.Families(records)...)
 	if err != nil {
 		return nil, apperror.Wrap(err)
 	}
-	return address, nil
+	return addresses, nil
+}
+
+// GetConsensus returns the latest consensus round of every family and the rounds in which address sources disagreed
+func GetConsensus(c *Context) (interface{}, error) {
+	return map[string]interface{}{
+		"quorum":        config.Get().Service.Quorum,
+		"rounds":        dns.LastRounds(),
+		"disagreements": dns.Disagreements(),
+	}, nil
 }
 
 func GetAddress(c *Context) (interface{}, error) {
@@ -95,7 +126,7 @@ func GetAddress(c *Context) (interface{}, error) {
 	return address, nil
 }
 
-// Stream address sends the current address the first time and every change
+// Stream address sends the current address of every uplink and family the first time and every change
 func streamAddress(c *Context) (interface{}, error) {
 	for {
 		_, _, err := c.conn.ReadMessage()
@@ -103,9 +134,9 @@ func streamAddress(c *Context) (interface{}, error) {
 			return nil, nil
 		}
 
-		var current *model.Address
+		var current []model.Address
 		err = database.Execute(func(db *gorm.DB) error {
-			err := db.Where("current = ?", true).First(&current).Error
+			err := db.Where("current = ?", true).Order("uplink").Order("family").Find(&current).Error
 			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 				return err
 			}
@@ -135,23 +166,20 @@ func GetHistory(c *Context) (interface{}, error) {
 	return addresses, nil
 }
 
-// DeleteHistory deletes the history of addresses except the most recent one.
+// DeleteHistory deletes the history of addresses except the current one of every family.
 func DeleteHistory(c *Context) (interface{}, error) {
 	var addresses []model.Address
 	err := database.Execute(func(db *gorm.DB) error {
-		return db.Order("created_at DESC").Find(&addresses).Error
+		return db.Where("current = ?", false).Find(&addresses).Error
 	})
 	if err != nil {
 		return nil, apperror.NewError("failed to fetch addresses").AddError(err)
 	}
 
-	if len(addresses) <= 1 {
+	if len(addresses) == 0 {
 		return nil, apperror.NewError("no history to delete")
 	}
 
-	// Keep the most recent address and delete the rest
-	addresses = addresses[1:]
-
 	err = database.Execute(func(db *gorm.DB) error {
 		return db.Delete(&addresses).Error
 	})
@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"os"
+	"reflect"
 	"slices"
 	"strings"
 
@@ -50,6 +51,9 @@ func UpdateConfig(c *Context) (interface{}, error) {
 		return nil, apperror.NewError("invalid configuration").AddError(err)
 	}
 	cfg := config.Get()
+	if !reflect.DeepEqual(cfg.Service.CommandSources(), newConfig.CommandSources()) {
+		return nil, apperror.NewError("command sources run executables and can only be changed in the configuration file")
+	}
 	cfg.Service = newConfig
 	err = config.Write(&cfg)
 	if err != nil {
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/hdns/pkg/dns"
+)
+
+func init() {
+	RegisterEndpoint(
+		EndpointTransportHTTP,
+		EndpointEncodingJSON,
+		[]string{
+			"/api/object/health",
+		}, map[string]Handler{
+			"GET":    GetHealth,
+			"DELETE": DeleteHealth,
+			"OPTIONS": func(context *Context) (interface{}, error) {
+				return nil, nil
+			},
+		})
+}
+
+// GetHealth returns the success, failure and latency statistics of all resolvers and DNS servers
+func GetHealth(c *Context) (interface{}, error) {
+	return dns.HealthStats(), nil
+}
+
+// DeleteHealth resets the statistics so resolvers in a cool-down are tried again
+func DeleteHealth(c *Context) (interface{}, error) {
+	err := dns.ResetHealth()
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
+	return dns.HealthStats(), nil
+}
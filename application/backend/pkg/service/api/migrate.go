@@ -0,0 +1,32 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/Valentin-Kaiser/go-core/apperror"
+	"github.com/Valentin-Kaiser/hdns/pkg/dns"
+)
+
+func init() {
+	RegisterEndpoint(
+		EndpointTransportHTTP,
+		EndpointEncodingJSON,
+		[]string{
+			"/api/action/migrate",
+		}, map[string]Handler{
+			"POST": Migrate,
+			"OPTIONS": func(context *Context) (interface{}, error) {
+				return nil, nil
+			},
+		})
+}
+
+// Migrate copies a zone from the Hetzner DNS Console to Hetzner Cloud DNS and re-points its records
+func Migrate(c *Context) (interface{}, error) {
+	var migration dns.Migration
+	err := json.NewDecoder(c.req.Body).Decode(&migration)
+	if err != nil {
+		return nil, apperror.NewError("failed to decode request body").AddError(err)
+	}
+	return dns.Migrate(migration)
+}
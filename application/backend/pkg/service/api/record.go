@@ -3,9 +3,11 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"strings"
 
 	"github.com/Valentin-Kaiser/go-core/apperror"
 	"github.com/Valentin-Kaiser/go-core/database"
+	"github.com/Valentin-Kaiser/hdns/pkg/config"
 	"github.com/Valentin-Kaiser/hdns/pkg/dns"
 	"github.com/Valentin-Kaiser/hdns/pkg/model"
 	"github.com/rs/zerolog/log"
@@ -59,16 +61,16 @@ func RefreshRecord(c *Context) (interface{}, error) {
 	}
 	var record model.Record
 	err := database.Execute(func(db *gorm.DB) error {
-		return db.First(&record, id).Error
+		return db.Preload("Targets").First(&record, id).Error
 	})
 	if err != nil {
 		return nil, apperror.NewError("failed to find record").AddError(err)
 	}
-	address, err := dns.UpdateAddress()
+	addresses, err := dns.UpdateAddresses(record.Uplink, dns.Families([]*model.Record{&record})...)
 	if err != nil {
 		return nil, apperror.Wrap(err)
 	}
-	err = dns.UpdateRecord(&record, address)
+	err = dns.UpdateRecord(&record, addresses)
 	if err != nil {
 		return nil, apperror.Wrap(err)
 	}
@@ -79,7 +81,7 @@ func RefreshRecord(c *Context) (interface{}, error) {
 func GetRecord(c *Context) (interface{}, error) {
 	var records []model.Record
 	err := database.Execute(func(db *gorm.DB) error {
-		return db.Preload("Address").Find(&records).Error
+		return db.Preload("Address").Preload("AddressV6").Preload("Targets").Find(&records).Error
 	})
 	if err != nil {
 		return nil, apperror.NewError("failed to find records").AddError(err)
@@ -124,6 +126,18 @@ func CreateRecord(c *Context) (interface{}, error) {
 	if err != nil {
 		return nil, apperror.Wrap(err)
 	}
+	err = validateProviders(&record, nil)
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
+	err = record.ValidateFollow()
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
+	err = validateUplink(&record)
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
 
 	var existingRecord model.Record
 	err = database.Execute(func(db *gorm.DB) error {
@@ -162,6 +176,26 @@ func UpdateRecord(c *Context) (interface{}, error) {
 		return nil, apperror.NewError("record ID is required")
 	}
 
+	var current model.Record
+	err = database.Execute(func(db *gorm.DB) error {
+		return db.Preload("Targets").First(&current, record.ID).Error
+	})
+	if err != nil {
+		return nil, apperror.NewError("failed to find record").AddError(err)
+	}
+	err = validateProviders(&record, &current)
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
+	err = record.ValidateFollow()
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
+	err = validateUplink(&record)
+	if err != nil {
+		return nil, apperror.Wrap(err)
+	}
+
 	var existingRecord model.Record
 	err = database.Execute(func(db *gorm.DB) error {
 		return db.Where("name = ? AND zone_id = ? AND id != ?", record.Name, record.ZoneID, record.ID).First(&existingRecord).Error
@@ -171,7 +205,76 @@ func UpdateRecord(c *Context) (interface{}, error) {
 	}
 
 	err = database.Execute(func(db *gorm.DB) error {
-		return db.Model(&model.Record{}).Where("id = ?", record.ID).Updates(record).Error
+		return db.Transaction(func(tx *gorm.DB) error {
+			var stored model.Record
+			err := tx.First(&stored, record.ID).Error
+			if err != nil {
+				return err
+			}
+			// The provider record IDs are only known to the server and belong to the stored provider and zone
+			record.ProviderRecordID, record.ProviderRecordIDV6 = stored.ProviderRecordID, stored.ProviderRecordIDV6
+			if moved(stored.Credential, stored.ZoneID, record.Credential, record.ZoneID) {
+				record.ProviderRecordID, record.ProviderRecordIDV6 = "", ""
+			}
+
+			err = tx.Model(&model.Record{}).Where("id = ?", record.ID).Omit(clause.Associations).Updates(record).Error
+			if err != nil {
+				return err
+			}
+
+			// Settings that can be switched off are zero values which Updates skips
+			err = tx.Model(&model.Record{}).Where("id = ?", record.ID).Updates(map[string]any{
+				"proxied":               record.Proxied,
+				"ipv6_prefix":           record.IPv6Prefix,
+				"ipv6_suffix":           record.IPv6Suffix,
+				"follow":                record.Follow,
+				"uplink":                record.Uplink,
+				"provider_record_id":    record.ProviderRecordID,
+				"provider_record_id_v6": record.ProviderRecordIDV6,
+			}).Error
+			if err != nil {
+				return err
+			}
+
+			// Replace the mirror targets with the submitted ones
+			keep := []uint64{}
+			for i := range record.Targets {
+				t := &record.Targets[i]
+				t.RecordID = record.ID
+				t.ProviderRecordID, t.ProviderRecordIDV6 = "", ""
+				if t.ID == 0 {
+					continue
+				}
+				// A submitted ID must not take over the target of another record
+				var existing model.Target
+				err = tx.Where("id = ? AND record_id = ?", t.ID, record.ID).First(&existing).Error
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return apperror.NewErrorf("target %d does not belong to record %d", t.ID, record.ID)
+				}
+				if err != nil {
+					return err
+				}
+				if !moved(existing.Credential, existing.ZoneID, t.Credential, t.ZoneID) {
+					t.ProviderRecordID, t.ProviderRecordIDV6 = existing.ProviderRecordID, existing.ProviderRecordIDV6
+				}
+				keep = append(keep, t.ID)
+			}
+			query := tx.Where("record_id = ?", record.ID)
+			if len(keep) > 0 {
+				query = query.Where("id NOT IN ?", keep)
+			}
+			err = query.Delete(&model.Target{}).Error
+			if err != nil {
+				return err
+			}
+			for i := range record.Targets {
+				err = tx.Omit(clause.Associations).Save(&record.Targets[i]).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
 	})
 	if err != nil {
 		return nil, apperror.NewError("failed to update record").AddError(err)
@@ -188,15 +291,19 @@ func DeleteRecord(c *Context) (interface{}, error) {
 
 	var record model.Record
 	err := database.Execute(func(db *gorm.DB) error {
-		return db.First(&record, id).Error
+		return db.Preload("Targets").First(&record, id).Error
 	})
 	if err != nil {
 		return nil, apperror.NewError("failed to find record").AddError(err)
 	}
 
-	// Get the query parameter if the record should be deleted from Hetzner
-	deleteFromHetzner := c.req.URL.Query().Get("delete_from_hetzner")
-	if deleteFromHetzner == "true" {
+	// Get the query parameter if the record should be deleted from the provider, delete_from_hetzner is its old name
+	query := c.req.URL.Query()
+	deleteFromProvider := query.Get("delete_from_provider")
+	if !query.Has("delete_from_provider") {
+		deleteFromProvider = query.Get("delete_from_hetzner")
+	}
+	if deleteFromProvider == "true" {
 		err := dns.DeleteRecord(&record)
 		if err != nil {
 			return nil, apperror.Wrap(err)
@@ -204,7 +311,13 @@ func DeleteRecord(c *Context) (interface{}, error) {
 	}
 
 	err = database.Execute(func(db *gorm.DB) error {
-		return db.Delete(&model.Record{}, id).Error
+		return db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Where("record_id = ?", record.ID).Delete(&model.Target{}).Error
+			if err != nil {
+				return err
+			}
+			return tx.Delete(&model.Record{}, id).Error
+		})
 	})
 	if err != nil {
 		return nil, apperror.NewError("failed to delete record").AddError(err)
@@ -212,3 +325,64 @@ func DeleteRecord(c *Context) (interface{}, error) {
 
 	return nil, nil
 }
+
+// validateProviders ensures the record and all of its mirror targets use a known provider and name their zones correctly
+// The zone names are only looked up at the providers when the zone or the credential differs from the stored record
+func validateProviders(record *model.Record, stored *model.Record) error {
+	domain := ""
+	if stored != nil && stored.Credential == record.Credential && stored.ZoneID == record.ZoneID {
+		domain = stored.Domain
+	}
+	err := validateZone(record.Credential, record.ZoneID, record.Domain, domain)
+	if err != nil {
+		return apperror.Wrap(err)
+	}
+
+	for i := range record.Targets {
+		t := &record.Targets[i]
+		domain := ""
+		if stored != nil {
+			for _, existing := range stored.Targets {
+				if existing.ID == t.ID && existing.Credential == t.Credential && existing.ZoneID == t.ZoneID {
+					domain = existing.Domain
+				}
+			}
+		}
+		err := validateZone(t.Credential, t.ZoneID, t.Domain, domain)
+		if err != nil {
+			return apperror.NewErrorf("mirror target %s.%s is invalid", record.Name, t.Domain).AddError(err)
+		}
+	}
+	return nil
+}
+
+// validateZone checks the domain against the name of the zone, which is looked up at the provider if it is not known yet
+func validateZone(c model.Credential, zoneID, domain, name string) error {
+	if name == "" {
+		var err error
+		name, err = dns.ZoneName(c, zoneID)
+		if err != nil {
+			return apperror.Wrap(err)
+		}
+	}
+	if !strings.EqualFold(strings.TrimSuffix(domain, "."), strings.TrimSuffix(name, ".")) {
+		return apperror.NewErrorf("domain %s does not match the zone %s named %s on %s", domain, zoneID, name, c.Provider)
+	}
+	return nil
+}
+
+// moved reports whether a record or target now lives at another provider, endpoint or zone
+func moved(old model.Credential, oldZoneID string, c model.Credential, zoneID string) bool {
+	return old.Provider != c.Provider || old.Endpoint != c.Endpoint || oldZoneID != zoneID
+}
+
+// validateUplink checks that the uplink the record publishes the addresses of is configured
+func validateUplink(record *model.Record) error {
+	if record.Uplink == "" {
+		return nil
+	}
+	if _, ok := config.Get().Service.Uplink(record.Uplink); !ok {
+		return apperror.NewErrorf("uplink %s is not configured", record.Uplink)
+	}
+	return nil
+}
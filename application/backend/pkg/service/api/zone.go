@@ -3,6 +3,7 @@ package api
 import (
 	"github.com/Valentin-Kaiser/go-core/apperror"
 	"github.com/Valentin-Kaiser/hdns/pkg/dns"
+	"github.com/Valentin-Kaiser/hdns/pkg/model"
 )
 
 func init() {
@@ -17,12 +18,39 @@ func init() {
 				return nil, nil
 			},
 		})
+
+	RegisterEndpoint(
+		EndpointTransportHTTP,
+		EndpointEncodingJSON,
+		[]string{
+			"/api/object/provider",
+		}, map[string]Handler{
+			"GET": GetProvider,
+			"OPTIONS": func(context *Context) (interface{}, error) {
+				return nil, nil
+			},
+		})
 }
 
+// GetZone lists the zones of a provider, the provider defaults to hetzner
 func GetZone(c *Context) (interface{}, error) {
 	token := c.req.PathValue("token")
 	if token == "" {
 		return nil, apperror.NewError("API token is required")
 	}
-	return dns.FetchZones(token)
+
+	credential := model.Credential{
+		Provider: c.req.URL.Query().Get("provider"),
+		Endpoint: c.req.URL.Query().Get("endpoint"),
+		Token:    model.Token(token),
+	}
+	if credential.Provider == "" {
+		credential.Provider = "hetzner"
+	}
+	return dns.FetchZones(credential)
+}
+
+// GetProvider lists the names of all supported DNS providers
+func GetProvider(c *Context) (interface{}, error) {
+	return dns.Providers(), nil
 }
@@ -4,7 +4,7 @@ import { catchError, defer, finalize, Observable, retry, shareReplay, Subject, t
 import { webSocket, WebSocketSubject, WebSocketSubjectConfig } from 'rxjs/webSocket';
 import { environment } from "src/environments/environment";
 import { LoggerService } from "../logger/logger.service";
-import { Address, Zone as DnsZone, Record, Resolution } from "./model/object";
+import { Address, Consensus, Health, Zone as DnsZone, Record, Resolution } from "./model/object";
 
 export interface Stream<TOut, TIn> {
     messages$: Observable<TOut>;
@@ -34,7 +34,7 @@ export class ApiService {
     }
 
     public address() {
-        return this.stream<Address, null>('stream/address');
+        return this.stream<Address[], null>('stream/address');
     }
 
     public records() {
@@ -49,12 +49,31 @@ export class ApiService {
         return this.get("object/history");
     }
 
+    public consensus(): Observable<Consensus> {
+        return this.get("object/consensus");
+    }
+
+    public health(): Observable<Health[]> {
+        return this.get("object/health");
+    }
+
+    public resetHealth(): Observable<Health[]> {
+        return this.delete("object/health");
+    }
+
     public refresh(id: number): Observable<Record> {
         return this.get(`action/refresh/record/${id}`);
     }
 
-    public zones(token: string): Observable<DnsZone[]> {
-        return this.get(`object/zone/${token}`);
+    public zones(record: Record): Observable<DnsZone[]> {
+        return this.get(`object/zone/${encodeURIComponent(record.token)}`, {
+            provider: record.provider || 'hetzner',
+            endpoint: record.endpoint || '',
+        });
+    }
+
+    public providers(): Observable<string[]> {
+        return this.get("object/provider");
     }
 
     public config(): Observable<any> {
@@ -77,8 +96,8 @@ export class ApiService {
         return this.put(`object/record`, record);
     }
 
-    public deleteRecord(record: Record, delete_from_hetzner: boolean): Observable<any> {
-        return this.delete(`object/record/${record.id}?delete_from_hetzner=${delete_from_hetzner}`);
+    public deleteRecord(record: Record, delete_from_provider: boolean): Observable<any> {
+        return this.delete(`object/record/${record.id}?delete_from_provider=${delete_from_provider}`);
     }
 
     public updateConfig(config: any): Observable<any> {
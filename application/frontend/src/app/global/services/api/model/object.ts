@@ -6,16 +6,53 @@ export interface BaseModel {
 
 export interface Address extends BaseModel {
     ip: string;
+    family: 'ipv4' | 'ipv6';
+    nat?: '' | 'none' | 'cgnat' | 'double_nat';
+    wan?: string;
+    uplink?: string;
 }
 
 export interface Record extends BaseModel {
+    provider: string;
+    endpoint: string;
     token: string;
     zone_id: string;
     domain: string;
     name: string;
     ttl: number;
+    proxied: boolean;
+    type: 'A' | 'AAAA' | 'both';
+    ipv6_prefix?: number;
+    ipv6_suffix?: string;
+    follow?: string;
+    uplink?: string;
+    provider_record_id?: string;
+    provider_record_id_v6?: string;
     address_id?: number;
     address?: Address;
+    address_v6_id?: number;
+    address_v6?: Address;
+    last_update: string; // ISO date string
+    status: string;
+    error: string;
+    targets: Target[];
+}
+
+export interface Target extends BaseModel {
+    record_id: number;
+    provider: string;
+    endpoint: string;
+    token: string;
+    zone_id: string;
+    domain: string;
+    provider_record_id?: string;
+    provider_record_id_v6?: string;
+    status: string;
+    error: string;
+    address_id?: number;
+    address?: Address;
+    address_v6_id?: number;
+    address_v6?: Address;
     last_update: string; // ISO date string
 }
 
@@ -39,6 +76,45 @@ export interface Config {
     web_port: number;
     refresh_interval: string;
     dns_servers: string[];
+    address_sources: AddressSource[];
+    quorum: number;
+    resolvers: Resolver[];
+    watch_interface: string;
+    uplinks: Uplink[];
+}
+
+export interface Uplink {
+    name: string;
+    interface?: string;
+    local_addresses?: string[];
+    address_sources?: AddressSource[];
+}
+
+export interface Resolver {
+    url: string;
+    method?: string;
+    headers?: { [name: string]: string };
+    timeout?: number;
+    parse?: string;
+    pattern?: string;
+}
+
+export interface AddressSource {
+    type: string;
+    interface?: string;
+    url?: string;
+    username?: string;
+    password?: string;
+    servers?: string[];
+    query?: string;
+    query_type?: string;
+    command?: string;
+    args?: string[];
+    timeout?: number;
+    token?: string;
+    resource?: string;
+    name?: string;
+    selector?: string;
 }
 
 export interface Resolution {
@@ -46,4 +122,43 @@ export interface Resolution {
     addresses: string[];
     response_time: number;
     error: string | null;
-}
\ No newline at end of file
+}
+
+export interface Vote {
+    source: string;
+    address?: string;
+    error?: string;
+}
+
+export interface ConsensusRound {
+    uplink?: string;
+    family: string;
+    address?: string;
+    agreed: number;
+    required: number;
+    disagreement: boolean;
+    votes: Vote[];
+    time: string; // ISO date string
+}
+
+export interface Consensus {
+    quorum: number;
+    rounds: ConsensusRound[];
+    disagreements: ConsensusRound[];
+}
+
+export interface Health {
+    id: number;
+    kind: string;
+    family: string;
+    name: string;
+    successes: number;
+    failures: number;
+    consecutive_failures: number;
+    reliability: number;
+    latency: number;
+    last_error: string;
+    last_success?: string; // ISO date string
+    last_failure?: string; // ISO date string
+    skip_until?: string; // ISO date string
+}
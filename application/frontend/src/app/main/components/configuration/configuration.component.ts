@@ -3,7 +3,7 @@ import { Component, EventEmitter, OnChanges, OnInit, Output } from '@angular/cor
 import { FormBuilder, FormGroup, FormsModule, ReactiveFormsModule } from '@angular/forms';
 import { IonicModule } from '@ionic/angular';
 import { ApiService } from '../../../global/services/api/api.service';
-import { Config } from '../../../global/services/api/model/object';
+import { AddressSource, Config, Resolver, Uplink } from '../../../global/services/api/model/object';
 import { NotifyService } from '../../../global/services/notify/notify.service';
 
 @Component({
@@ -47,10 +47,14 @@ export class ConfigurationComponent implements OnInit, OnChanges {
     this.apiService.config().subscribe({
       next: (config: Config) => {
         this.config = { ...config };
+        this.config.address_sources = this.config.address_sources?.length ? this.config.address_sources : [{ type: 'http' }];
+        this.config.resolvers = this.config.resolvers || [];
         this.formGroup = this.formBuilder.group({
           log_level: [this.config.log_level],
           web_port: [this.config.web_port],
           refresh_interval: [this.config.refresh_interval],
+          quorum: [this.config.quorum],
+          watch_interface: [this.config.watch_interface],
           dns_servers: [],
         });
       },
@@ -74,6 +78,8 @@ export class ConfigurationComponent implements OnInit, OnChanges {
     this.config.log_level = this.formGroup.value.log_level;
     this.config.web_port = this.formGroup.value.web_port;
     this.config.refresh_interval = this.formGroup.value.refresh_interval;
+    this.config.quorum = Number(this.formGroup.value.quorum) || 0;
+    this.config.watch_interface = (this.formGroup.value.watch_interface || '').trim();
 
     this.apiService.updateConfig(this.config).subscribe({
       next: (updatedConfig: Config) => {
@@ -117,6 +123,78 @@ export class ConfigurationComponent implements OnInit, OnChanges {
     this.dirty();
   }
 
+  addSource() {
+    this.config.address_sources.push({ type: 'http' });
+    this.dirty();
+  }
+
+  removeSource(index: number) {
+    if (this.config.address_sources.length > 1) {
+      this.config.address_sources.splice(index, 1);
+    }
+    this.dirty();
+  }
+
+  updateSource(index: number, field: keyof AddressSource, value) {
+    if (this.config.address_sources.length > index) {
+      this.config.address_sources[index] = { ...this.config.address_sources[index], [field]: value };
+    }
+    this.dirty();
+  }
+
+  addResolver() {
+    this.config.resolvers = [...(this.config.resolvers || []), { url: '' }];
+    this.dirty();
+  }
+
+  removeResolver(index: number) {
+    this.config.resolvers.splice(index, 1);
+    this.dirty();
+  }
+
+  updateResolver(index: number, field: keyof Resolver, value) {
+    if (this.config.resolvers.length > index) {
+      this.config.resolvers[index] = { ...this.config.resolvers[index], [field]: value };
+    }
+    this.dirty();
+  }
+
+  addUplink() {
+    this.config.uplinks = [...(this.config.uplinks || []), { name: '' }];
+    this.dirty();
+  }
+
+  removeUplink(index: number) {
+    this.config.uplinks.splice(index, 1);
+    this.dirty();
+  }
+
+  updateUplink(index: number, field: keyof Uplink, value) {
+    if (this.config.uplinks.length > index) {
+      this.config.uplinks[index] = { ...this.config.uplinks[index], [field]: value };
+    }
+    this.dirty();
+  }
+
+  formatHeaders(headers: { [name: string]: string }): string {
+    return Object.entries(headers || {}).map(([name, value]) => `${name}: ${value}`).join('; ');
+  }
+
+  parseHeaders(value: string): { [name: string]: string } {
+    const headers = {};
+    for (const header of (value || '').split(';')) {
+      const [name, ...rest] = header.split(':');
+      if (name.trim() !== '' && rest.length > 0) {
+        headers[name.trim()] = rest.join(':').trim();
+      }
+    }
+    return headers;
+  }
+
+  splitList(value: string): string[] {
+    return (value || '').split(',').map(s => s.trim()).filter(s => s !== '');
+  }
+
   dirty() {
     this.formGroup.markAsDirty();
     if (this.config.dns_servers.some(s => !s || s.trim() === '')) {
@@ -18,7 +18,7 @@ import { NotifyService } from '../../../global/services/notify/notify.service';
   ]
 })
 export class HistoryComponent implements OnInit, OnChanges {
-  @Input() current: Address | null = null;
+  @Input() current: Address[] = [];
   @Output() onClose = new EventEmitter<void>();
 
   history: Address[] = [];
@@ -54,6 +54,10 @@ export class HistoryComponent implements OnInit, OnChanges {
     });
   }
 
+  isCurrent(address: Address): boolean {
+    return this.current.some(a => a.id === address.id);
+  }
+
   getFormattedDate(dateString: string): string {
     return this.formatDuration(new Date(dateString).getTime() / 1000, Date.now() / 1000);
   }
@@ -3,7 +3,7 @@ import { Component, EventEmitter, Input, OnChanges, OnInit, Output } from '@angu
 import { FormsModule } from '@angular/forms';
 import { IonicModule } from '@ionic/angular';
 import { ApiService } from '../../../global/services/api/api.service';
-import { Zone as DnsZone, Record } from '../../../global/services/api/model/object';
+import { Zone as DnsZone, Record, Uplink } from '../../../global/services/api/model/object';
 import { NotifyService } from '../../../global/services/notify/notify.service';
 
 @Component({
@@ -20,6 +20,8 @@ export class RecordFormComponent implements OnInit, OnChanges {
 
   loading: boolean = false;
   zones: DnsZone[] = [];
+  providers: string[] = [];
+  uplinks: string[] = [];
   tokenError = false;
 
   formSteps = {
@@ -34,7 +36,27 @@ export class RecordFormComponent implements OnInit, OnChanges {
   ) { }
 
   ngOnInit() {
+    this.apiService.providers().subscribe({
+      next: (response) => {
+        this.providers = response || [];
+      },
+      error: (error) => {
+        this.notifyService.presentErrorToast('Failed to load DNS providers', error);
+      }
+    });
+
+    this.apiService.config().subscribe({
+      next: (response) => {
+        this.uplinks = (response?.uplinks || []).map((u: Uplink) => u.name);
+      },
+      error: (error) => {
+        this.notifyService.presentErrorToast('Failed to load uplinks', error);
+      }
+    });
+
     if (this.record) {
+      this.record.provider = this.record.provider || 'hetzner';
+      this.record.type = this.record.type || 'A';
       this.validateFormSteps();
       if (this.record.token) {
         this.loadZones();
@@ -67,7 +89,7 @@ export class RecordFormComponent implements OnInit, OnChanges {
 
     this.zones = [];
     this.tokenError = false;
-    this.apiService.zones(this.record.token).subscribe({
+    this.apiService.zones(this.record).subscribe({
       next: (response) => {
         this.zones = response || [];
         this.tokenError = false;
@@ -82,6 +104,16 @@ export class RecordFormComponent implements OnInit, OnChanges {
     });
   }
 
+  setProvider(provider: string) {
+    if (this.record) {
+      this.record.provider = provider;
+      this.record.zone_id = '';
+      this.record.domain = '';
+      this.validateFormSteps();
+      this.loadZones();
+    }
+  }
+
   setZone(zoneId: string) {
     if (this.record) {
       this.record.zone_id = zoneId;
@@ -100,6 +132,12 @@ export class RecordFormComponent implements OnInit, OnChanges {
       return;
     }
 
+    if (this.record.type === 'A' || !this.record.ipv6_prefix) {
+      this.record.ipv6_prefix = 0;
+      this.record.ipv6_suffix = '';
+    }
+    this.record.follow = (this.record.follow || '').trim();
+
     this.loading = true;
     let action = this.record.id ? this.apiService.updateRecord(this.record) : this.apiService.createRecord(this.record);
     action.subscribe({
@@ -13,7 +13,7 @@ import { Address, Record } from '../../../global/services/api/model/object';
 })
 export class RecordComponent {
   @Input() records: Record[] = [];
-  @Input() current: Address | null = null;
+  @Input() current: Address[] = [];
 
   @Output() addRecord = new EventEmitter<void>();
   @Output() editRecord = new EventEmitter<Record>();
@@ -22,7 +22,22 @@ export class RecordComponent {
   @Output() showRecordResolution = new EventEmitter<Record>();
 
   isRecordUpdated(record: Record): boolean {
-    return record.address_id === this.current?.id;
+    // Every uplink has its own current addresses
+    const current = this.current.filter(a => (a.uplink || '') === (record.uplink || ''));
+    const v4 = current.find(a => a.family === 'ipv4');
+    const v6 = current.find(a => a.family === 'ipv6');
+    const type = record.type || 'A';
+    if (record.follow) {
+      // Followed addresses are resolved on each refresh and not part of the address history
+      return record.status === 'ok';
+    }
+    if (type !== 'AAAA' && record.address_id !== v4?.id) {
+      return false;
+    }
+    if (type !== 'A' && record.address_v6_id !== v6?.id) {
+      return false;
+    }
+    return true;
   }
 
   getLastUpdatedText(dateString: string): string {
@@ -32,7 +32,7 @@ import { RecordComponent } from './components/record/record.component';
 })
 export class MainPage implements OnInit, OnDestroy {
 
-  current: Address | null = null;
+  current: Address[] = [];
   records: Record[] = [];
   record: Record | null = null;
   isLoading = true;
@@ -61,8 +61,9 @@ export class MainPage implements OnInit, OnDestroy {
     const addressStream = this.apiService.address();
     this.subscriptions.push(addressStream.messages$.subscribe({
       next: (message) => {
-        if (!this.current || this.current.id !== message.id) {
-          this.current = message;
+        const next = message || [];
+        if (next.map(a => a.id + a.nat).join() !== this.current.map(a => a.id + a.nat).join()) {
+          this.current = next;
         }
       },
       error: (error) => {
@@ -147,13 +148,13 @@ export class MainPage implements OnInit, OnDestroy {
   }
 
   deleteRecord(record: Record) {
-    let deleteFromHetzner = false;
+    let deleteFromProvider = false;
     this.notifyService.showWarning(
       this,
       `Are you sure you want to delete the record ${record.name}.${record.domain}?`,
       () => { },
       () => {
-        this.apiService.deleteRecord(record, deleteFromHetzner).subscribe({
+        this.apiService.deleteRecord(record, deleteFromProvider).subscribe({
           next: () => {
             this.records = this.records.filter(r => r.id !== record.id);
             this.notifyService.presentToast(`Record ${record.name}.${record.domain} deleted`, 'Success');
@@ -172,10 +173,10 @@ export class MainPage implements OnInit, OnDestroy {
       "medium",
       "danger",
       true,
-      "Delete record from Hetzner DNS",
+      "Delete record from the DNS provider",
       false,
       (value: boolean) => {
-        deleteFromHetzner = value;
+        deleteFromProvider = value;
       }
     )
   }
@@ -196,6 +197,20 @@ export class MainPage implements OnInit, OnDestroy {
     }
   }
 
+  isBehindNAT(address: Address): boolean {
+    return address.nat === 'cgnat' || address.nat === 'double_nat';
+  }
+
+  natDescription(address: Address): string {
+    switch (address.nat) {
+      case 'cgnat':
+        return `The WAN address ${address.wan} belongs to a carrier-grade NAT, ${address.ip} is not reachable from the internet`;
+      case 'double_nat':
+        return `The WAN address ${address.wan} differs from ${address.ip}, another NAT makes it unreachable from the internet`;
+    }
+    return '';
+  }
+
   // IP History methods
   toggleHistory() {
     this.showHistory = !this.showHistory;